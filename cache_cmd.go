@@ -0,0 +1,199 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Skardyy/ttyimg/render"
+)
+
+// parses sizes like 512, 64K, 256MB, 1G into bytes
+func parse_size(input string) (int64, error) {
+	matches := regexp.MustCompile(`^(\d+)\s*([kmg]?)i?b?$`).FindStringSubmatch(strings.ToLower(input))
+	if matches == nil {
+		return 0, fmt.Errorf("invalid size: %s", input)
+	}
+	value, err := strconv.ParseInt(matches[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	switch matches[2] {
+	case "k":
+		value <<= 10
+	case "m":
+		value <<= 20
+	case "g":
+		value <<= 30
+	}
+	return value, nil
+}
+
+// like time.ParseDuration but also understands days, e.g 30d
+func parse_age(input string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(input, "d"); ok {
+		value, err := strconv.ParseFloat(days, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid age: %s", input)
+		}
+		return time.Duration(value * float64(24*time.Hour)), nil
+	}
+	return time.ParseDuration(input)
+}
+
+func format_size(size int64) string {
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.1fG", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1fM", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1fK", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", size)
+}
+
+func format_age(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	age := time.Since(t)
+	switch {
+	case age >= 24*time.Hour:
+		return fmt.Sprintf("%dd", int(age.Hours()/24))
+	case age >= time.Hour:
+		return fmt.Sprintf("%dh", int(age.Hours()))
+	case age >= time.Minute:
+		return fmt.Sprintf("%dm", int(age.Minutes()))
+	}
+	return fmt.Sprintf("%ds", int(age.Seconds()))
+}
+
+func cache_usage() {
+	purple := "\x1b[35m"
+	green := "\x1b[32m"
+	reset := "\x1b[0m"
+	fmt.Fprintln(os.Stderr, purple+"Usage: ttyimg cache <command>"+reset)
+	fmt.Fprintln(os.Stderr, green+"  list"+reset+"                                  lists the cached entries, least recently used first")
+	fmt.Fprintln(os.Stderr, green+"  stats"+reset+"                                 prints the size of the cache")
+	fmt.Fprintln(os.Stderr, green+"  prune -older-than <age> -max-size <size>"+reset+"  removes entries unused for <age> (e.g 30d, 12h) / evicts until the cache fits <size>")
+	fmt.Fprintln(os.Stderr, green+"  rm <path>"+reset+"                             removes the entries of <path>")
+	fmt.Fprintln(os.Stderr, green+"  clear"+reset+"                                 removes every entry")
+	os.Exit(1)
+}
+
+// runs `ttyimg cache ...`
+func cache_cmd(args []string) {
+	if len(args) < 1 {
+		cache_usage()
+	}
+
+	var err error
+	switch args[0] {
+	case "list":
+		err = cache_list()
+	case "stats":
+		err = cache_stats()
+	case "prune":
+		err = cache_prune(args[1:])
+	case "rm":
+		if len(args) < 2 {
+			cache_usage()
+		}
+		for _, path := range args[1:] {
+			var removed int
+			removed, err = render.RemoveCached(path)
+			if err != nil {
+				break
+			}
+			fmt.Printf("removed %d entries of %s\n", removed, path)
+		}
+	case "clear":
+		var removed int
+		removed, err = render.ClearCache()
+		if err == nil {
+			fmt.Printf("removed %d entries\n", removed)
+		}
+	default:
+		cache_usage()
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func cache_list() error {
+	entries, err := render.ListCache()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		fmt.Printf("%8s  %6s  %s  %s\n", format_size(int64(entry.Size)), format_age(entry.LastUsed()), entry.Path, entry.Params)
+	}
+	return nil
+}
+
+func cache_stats() error {
+	entries, err := render.ListCache()
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, entry := range entries {
+		total += int64(entry.Size)
+	}
+
+	fmt.Printf("location: %s\n", render.CacheLocation())
+	fmt.Printf("entries:  %d\n", len(entries))
+	fmt.Printf("used:     %s\n", format_size(total))
+	if info, err := os.Stat(render.CacheLocation()); err == nil {
+		fmt.Printf("on disk:  %s\n", format_size(info.Size()))
+	}
+	if len(entries) > 0 {
+		fmt.Printf("oldest:   %s\n", format_age(entries[0].LastUsed()))
+		fmt.Printf("newest:   %s\n", format_age(entries[len(entries)-1].LastUsed()))
+	}
+	return nil
+}
+
+func cache_prune(args []string) error {
+	var olderThan string
+	var maxSize string
+	flags := flag.NewFlagSet("prune", flag.ExitOnError)
+	flags.StringVar(&olderThan, "older-than", "", "removes entries that weren't used for this long, e.g 30d, 12h")
+	flags.StringVar(&maxSize, "max-size", "", "evicts the least recently used entries until the cache fits, e.g 256MB")
+	flags.Parse(args)
+	if olderThan == "" && maxSize == "" {
+		cache_usage()
+	}
+
+	if olderThan != "" {
+		age, err := parse_age(olderThan)
+		if err != nil {
+			return err
+		}
+		removed, err := render.PruneCache(age)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("removed %d entries unused for %s\n", removed, olderThan)
+	}
+	if maxSize != "" {
+		size, err := parse_size(maxSize)
+		if err != nil {
+			return err
+		}
+		removed, err := render.TrimCache(size)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("evicted %d entries to fit in %s\n", removed, maxSize)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int64
+		wantErr bool
+	}{
+		{"0", 0, false},
+		{"512", 512, false},
+		{"512b", 512, false},
+		{"10k", 10 << 10, false},
+		{"10KB", 10 << 10, false},
+		{"256MB", 256 << 20, false},
+		{"256 mib", 256 << 20, false},
+		{"2g", 2 << 30, false},
+		{"", 0, true},
+		{"-1", 0, true},
+		{"1.5g", 0, true},
+		{"10t", 0, true},
+		{"mb", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parse_size(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parse_size(%q) = %d, want an error", tt.input, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("parse_size(%q) = %d, %v, want %d", tt.input, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"30d", 30 * 24 * time.Hour, false},
+		{"0.5d", 12 * time.Hour, false},
+		{"12h", 12 * time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"d", 0, true},
+		{"30", 0, true},
+		{"week", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parse_age(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parse_age(%q) = %v, want an error", tt.input, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("parse_age(%q) = %v, %v, want %v", tt.input, got, err, tt.want)
+			}
+		})
+	}
+}
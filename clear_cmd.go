@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Skardyy/ttyimg/render"
+)
+
+// runs `ttyimg clear ...`
+func clear_cmd(args []string) {
+	var id uint
+	var placementId uint
+	var place string
+	var protocol string
+	var fallback string
+	var passthrough string
+	flags := flag.NewFlagSet("clear", flag.ExitOnError)
+	flags.UintVar(&id, "id", 0, "only clears the kitty image with this id")
+	flags.UintVar(&placementId, "placement-id", 0, "only clears this placement of the kitty image -id")
+	flags.StringVar(&place, "place", "", "<width>x<height>@<x>,<y> in cells. only clears the images inside that rectangle")
+	flags.StringVar(&protocol, "p", "auto", "Force protocol: kitty, iterm, sixel, blocks, braille, ascii")
+	flags.StringVar(&fallback, "f", "sixel", "fallback to when no protocol is supported: kitty, iterm, sixel, blocks, braille, ascii")
+	flags.StringVar(&passthrough, "passthrough", "auto", "wrap graphics for a terminal multiplexer: auto, tmux, screen, none")
+	flags.Usage = func() {
+		purple := "\x1b[35m"
+		reset := "\x1b[0m"
+		fmt.Fprintln(os.Stderr, purple+"Usage: ttyimg clear [options]"+reset)
+		fmt.Fprintln(os.Stderr, "  clears every kitty image when neither -id nor -place is given, sixel, iterm and text need -place")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	fail := func(err error) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	opts := render.DefaultOptions()
+	opts.ImageID = uint32(id)
+	opts.PlacementID = uint32(placementId)
+	opts.Fallback, _ = render.ParseProtocol(fallback)
+	var err error
+	if opts.Place, err = render.ParsePlace(place); err != nil {
+		fail(err)
+	}
+	if opts.Protocol, err = render.ParseProtocol(protocol); err != nil {
+		fail(err)
+	}
+	if opts.Passthrough, err = render.ParsePassthrough(passthrough); err != nil {
+		fail(err)
+	}
+	if err := render.Clear(os.Stdout, opts); err != nil {
+		fail(err)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// Config is read from <user config dir>/ttyimg/config.json, flags take precedence over it
+type Config struct {
+	// Converters is the order document converters are tried in, e.g ["mutool", "libreoffice"]
+	Converters []string `json:"converters"`
+}
+
+func get_config_path() string {
+	config_dir, _ := os.UserConfigDir()
+	return filepath.Join(config_dir, "ttyimg", "config.json")
+}
+
+// loads the config, a missing file gives the empty config
+func load_config(path string) (Config, error) {
+	config := Config{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return config, err
+	}
+	err = json.Unmarshal(data, &config)
+	return config, err
+}
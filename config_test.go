@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		wantErr bool
+	}{
+		{"converter order", `{"converters": ["mutool", "libreoffice"]}`, []string{"mutool", "libreoffice"}, false},
+		{"empty", `{}`, nil, false},
+		{"unknown keys", `{"theme": "dark"}`, nil, false},
+		{"invalid", `{"converters": "mutool"}`, nil, true},
+		{"not json", `converters = mutool`, nil, true},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, fmt.Sprintf("config%d.json", i))
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			config, err := load_config(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("load_config = %v, want an error", config)
+				}
+				return
+			}
+			if err != nil || strings.Join(config.Converters, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("load_config = %v, %v, want %v", config, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadMissingConfig(t *testing.T) {
+	config, err := load_config(filepath.Join(t.TempDir(), "config.json"))
+	if err != nil || config.Converters != nil {
+		t.Errorf("load_config = %v, %v, want the empty config", config, err)
+	}
+}
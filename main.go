@@ -1,45 +1,42 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"image"
-	"image/color/palette"
-	"image/draw"
-	_ "image/jpeg"
-	_ "image/png"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/BourgeoisBear/rasterm"
-	"github.com/boltdb/bolt"
+	"github.com/Skardyy/ttyimg/render"
 )
 
-func get_db_loc() string {
-	cache_dir, _ := os.UserCacheDir()
-	path := filepath.Join(cache_dir, "ttyimg")
-	_ = os.MkdirAll(path, 0755)
-
-	return filepath.Join(path, "ttyimg_cache.db")
+func get_log_path() string {
+	exePath, _ := os.Executable()
+	exeDir := filepath.Dir(exePath)
+	return filepath.Join(exeDir, "logs.log")
 }
 
-var logger = Logger{}
-var db_loc = get_db_loc()
-var db, _ = bolt.Open(db_loc, 0600, nil)
-var bucket_name = []byte("documents")
-
 const version = "1.0.5"
 
 func main() {
+	logger := render.Logger{}
 	logger.Init(get_log_path(), true)
+	render.SetLogger(&logger)
 	defer logger.Close()
-	defer db.Close()
-	db.Update(func(tx *bolt.Tx) error {
-		tx.CreateBucketIfNotExists(bucket_name)
-		return nil
-	})
+	if len(os.Args) > 1 && os.Args[1] == "cache" {
+		cache_cmd(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "clear" {
+		clear_cmd(os.Args[2:])
+		return
+	}
 	var widthPre string
 	var heightPre string
 	var protocol string
@@ -49,18 +46,90 @@ func main() {
 	var screenSizeCell string
 	var center bool
 	var cache bool
+	var cacheMax string
 	var scale string
+	var loop int
+	var page string
+	var converters string
+	var textColor bool
+	var colors int
+	var dither string
+	var pageLayout string
+	var passthrough string
+	var placeholder bool
+	var align string
+	var place string
+	var imageId uint
+	var placementId uint
+	var report string
+	var reportFd int
+	var noAutorotate bool
+	var rotate float64
+	var flip string
+	var region string
+	var adjustments []render.Adjustment
+	var autoInvert bool
+	var bg string
+	var queryTimeout time.Duration
 
 	flag.StringVar(&widthPre, "w", "80%", "Resize width: <number> (pixels) / <number>px / <number>c (cells) / <number>%")
 	flag.StringVar(&heightPre, "h", "60%", "Resize height: <number> (pixels) / <number>px / <number>c (cells) / <number>%")
 	flag.StringVar(&resizeMode, "m", "Fit", "the resize mode to use when resizing: Fit, Strech, Crop")
 	flag.BoolVar(&center, "center", true, "rather or not to center align the image")
-	flag.StringVar(&protocol, "p", "auto", "Force protocol: kitty, iterm, sixel")
-	flag.StringVar(&fallback, "f", "sixel", "fallback to when no protocol is supported: kitty, iterm, sixel")
+	flag.StringVar(&align, "align", "", "place the image on the screen: top, center, bottom and / or left, center, right, like top-left. empty draws it at the cursor")
+	flag.StringVar(&place, "place", "", "<width>x<height>@<x>,<y> in cells. fits the image into that rectangle of the screen and draws it there, leaving the cursor where it was")
+	flag.StringVar(&protocol, "p", "auto", "Force protocol: kitty, iterm, sixel, blocks, braille, ascii")
+	flag.StringVar(&fallback, "f", "sixel", "fallback to when no protocol is supported: kitty, iterm, sixel, blocks, braille, ascii")
 	flag.StringVar(&screenSizePx, "spx", "1920x1080", "<width>x<height> or <width>x<height>xForce. specify the size of the winodw in px for fallback / overwrite")
 	flag.StringVar(&screenSizeCell, "sc", "120x30", "<width>x<height> or <width>x<height>xForce. specify the size of the winodw in cell for fallback / overwrite")
 	flag.StringVar(&scale, "scale", "1x1", "<float>x<float> scales the spx and sc, only usefull for centering in smaller portions of the screen")
 	flag.BoolVar(&cache, "cache", true, "rather or not to cache the heavy operations")
+	flag.StringVar(&cacheMax, "cache-max", "256MB", "the size the cache is trimmed to, least recently used first. 0 for unlimited")
+	flag.BoolVar(&noAutorotate, "no-autorotate", false, "ignore the exif orientation of jpeg and tiff photos")
+	flag.Float64Var(&rotate, "rotate", 0, "turn the image clockwise: 90, 180, 270 or any angle in degrees, which leaves the corners transparent")
+	flag.StringVar(&flip, "flip", "", "mirror the image: h (left to right) or v (top to bottom)")
+	flag.StringVar(&region, "region", "", "<x>,<y>,<width>,<height> the part of the image to render, each in pixels, px, c (cells) or % of the image")
+	// the adjustments are chained in the order they are given
+	adjust := func(kind string) func(string) error {
+		return func(amount string) error {
+			a, err := render.ParseAdjustment(kind, amount)
+			if err != nil {
+				return err
+			}
+			adjustments = append(adjustments, a)
+			return nil
+		}
+	}
+	adjustBool := func(kind string) func(string) error {
+		return func(value string) error {
+			if on, err := strconv.ParseBool(value); err != nil || !on {
+				return err
+			}
+			return adjust(kind)("")
+		}
+	}
+	flag.Func("brightness", "<percent> lighten the image, negative darkens it. adjustments are applied in the order they are given", adjust("brightness"))
+	flag.Func("contrast", "<percent> raise the contrast, negative lowers it", adjust("contrast"))
+	flag.Func("gamma", "<float> above 1 brightens the midtones, below 1 darkens them", adjust("gamma"))
+	flag.Func("saturation", "<percent> raise the saturation, -100 removes the color", adjust("saturation"))
+	flag.BoolFunc("grayscale", "remove the color", adjustBool("grayscale"))
+	flag.BoolFunc("invert", "invert the colors", adjustBool("invert"))
+	flag.BoolVar(&autoInvert, "auto-invert", false, "invert images with a mostly white background when the terminal background is dark")
+	flag.StringVar(&bg, "bg", "transparent", "what transparent pixels are drawn over: #rrggbb, transparent, checkerboard, terminal (the terminal's own background)")
+	flag.DurationVar(&queryTimeout, "query-timeout", render.DefaultQueryTimeout, "how long to wait for the terminal to answer its size, colors and graphics support, raise it over slow ssh")
+	flag.StringVar(&page, "page", "1", "the page of documents to render: <number> or <first>-<last>, up to 16 pages")
+	flag.StringVar(&pageLayout, "page-layout", "stack", "how to arrange a range of pages: stack, grid")
+	flag.StringVar(&converters, "converters", "", "comma separated order to try document converters in, overrides the config: "+strings.Join(render.ConverterNames(), ", "))
+	flag.IntVar(&colors, "colors", 0, "the number of sixel colors, up to 256. 0 asks the terminal for its color registers")
+	flag.BoolVar(&textColor, "text-color", false, "rather or not to color the braille and ascii output")
+	flag.StringVar(&dither, "dither", "floyd-steinberg", "dithering for sixel, braille and 256 / 16 color text: none, floyd-steinberg, atkinson, bayer4, bayer8, blue-noise")
+	flag.StringVar(&passthrough, "passthrough", "auto", "wrap graphics for a terminal multiplexer: auto, tmux, screen, none")
+	flag.BoolVar(&placeholder, "placeholder", false, "place kitty images with unicode placeholders, so tmux and editors scroll and clip them like text")
+	flag.UintVar(&imageId, "id", 0, "the id of kitty images, so ttyimg clear -id can remove them later. 0 leaves them unnamed")
+	flag.UintVar(&placementId, "placement-id", 0, "the id of the placement of kitty images")
+	flag.StringVar(&report, "report", "", "report what was drawn once it is on the screen: json. empty reports nothing")
+	flag.IntVar(&reportFd, "report-fd", 2, "the file descriptor the report is written to, stderr by default")
+	flag.IntVar(&loop, "loop", render.LoopGif, "how many times to play animated gifs: 0 uses the gif's own loop count, -1 loops forever")
 	flag.BoolFunc("version", "prints the version number", func(s string) error {
 		println(version)
 		defer os.Exit(0)
@@ -74,7 +143,7 @@ func main() {
 			fmt.Printf("ttyimg version matches: '%s'\n", version)
 			defer os.Exit(0)
 		}
-		useIterm, useKitty, useSixel := detect_cap("")
+		useIterm, useKitty, useSixel := render.DetectCap("", render.PassthroughAuto, queryTimeout)
 		fmt.Printf("Iterm: %t, Kitty: %t, Sixel: %t", useIterm, useKitty, useSixel)
 		return nil
 	})
@@ -85,11 +154,17 @@ func main() {
 		green := "\x1b[32m"
 		purple := "\x1b[35m"
 		yellow := "\x1b[33m"
-		fmt.Fprintln(os.Stderr, purple+"Usage: ttyimg [options] <path_to_image>"+reset)
-		order := []string{"w", "h", "m", "center", "p", "f", "spx", "sc", "scale", "cache"}
+		fmt.Fprintln(os.Stderr, purple+"Usage: ttyimg [options] <path_to_image | ->"+reset)
+		fmt.Fprintln(os.Stderr, purple+"       ttyimg cache <list|stats|prune|rm|clear>"+reset)
+		fmt.Fprintln(os.Stderr, purple+"       ttyimg clear [-id <id>] [-place <width>x<height>@<x>,<y>]"+reset)
+		order := []string{"w", "h", "m", "center", "align", "place", "p", "f", "spx", "sc", "scale", "no-autorotate", "region", "rotate", "flip", "brightness", "contrast", "gamma", "saturation", "grayscale", "invert", "auto-invert", "bg", "query-timeout", "cache", "cache-max", "page", "page-layout", "converters", "colors", "text-color", "dither", "loop", "passthrough", "placeholder", "id", "placement-id", "report", "report-fd"}
 		for _, key := range order {
 			f := flag.Lookup(key)
-			fmt.Fprintln(os.Stderr, green+"  -"+key+reset, blue+determineType(f.DefValue)+reset)
+			kind := determineType(f.DefValue)
+			if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+				kind = "bool"
+			}
+			fmt.Fprintln(os.Stderr, green+"  -"+key+reset, blue+kind+reset)
 			fmt.Fprintln(os.Stderr, "        ", flag.Lookup(key).Usage, yellow+"(default:", f.DefValue+")"+reset)
 		}
 
@@ -101,113 +176,132 @@ func main() {
 		flag.Usage()
 		return
 	}
-	width, errWidth := ParseDimension(widthPre)
-	width.direction = X
-	height, errHeight := ParseDimension(heightPre)
-	height.direction = Y
+	width, errWidth := render.ParseDimension(widthPre)
+	height, errHeight := render.ParseDimension(heightPre)
 	if errWidth != nil || errHeight != nil {
 		return
 	}
-	imgPath := flag.Args()[0]
-
-	sSize := ScreenSize{}
-	sSize.query(screenSizePx, screenSizeCell, scale)
-	resizedImg := get_img(imgPath, width, height, resizeMode, cache, sSize)
-
-	if resizedImg == nil {
+	proto, errProto := render.ParseProtocol(protocol)
+	if errProto != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v.\n", errProto)
+		flag.PrintDefaults()
 		return
 	}
-
-	useKitty := false
-	useIterm := false
-	useSixel := false
-
-	switch strings.ToLower(protocol) {
-	case "kitty":
-		useKitty = true
-	case "iterm":
-		useIterm = true
-	case "sixel":
-		useSixel = true
-	case "auto": // Auto-detect
-		useIterm, useKitty, useSixel = detect_cap(fallback)
-	default:
-		fmt.Fprintf(os.Stderr, "Error: invalid protocol '%s'. Must be kitty, iterm, or sixel.\n", protocol)
-		flag.PrintDefaults()
+	fallbackProto, _ := render.ParseProtocol(fallback)
+	pages, errPages := render.ParsePageRange(page)
+	if errPages != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", errPages)
 		return
 	}
-
-	writer := NewBufferedWriter()
-	defer writer.Flush()
-
-	var offsetX int
-	if center {
-		offsetX, _ = CenterImage(resizedImg, sSize)
-		center_esc := fmt.Sprintf("\x1b[%dC", offsetX)
-		writer.WriteString(center_esc)
+	ditherAlgo, errDither := render.ParseDither(dither)
+	if errDither != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", errDither)
+		return
 	}
-
-	if useIterm {
-		err := rasterm.ItermWriteImage(writer, resizedImg)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error encoding to iTerm format: %v\n", err)
-			return
-		}
-	} else if useKitty {
-		opts := rasterm.KittyImgOpts{}
-		err := rasterm.KittyWriteImage(writer, resizedImg, opts)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error encoding to Kitty format: %v\n", err)
-			return
-		}
-	} else if useSixel {
-		pimg := convertToPaletted(resizedImg)
-		err := rasterm.SixelWriteImage(writer, pimg)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error encoding to Sixel format: %v\n", err)
-			return
-		}
-	} else {
-		fmt.Fprintln(os.Stderr, "No capable terminal detected (Kitty, iTerm, or Sixel), and no protocol forced.")
+	alignment, errAlign := render.ParseAlign(align)
+	if errAlign != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", errAlign)
 		return
 	}
-	writer.WriteString("\n")
-}
-
-func convertToPaletted(img image.Image) *image.Paletted {
-	bounds := img.Bounds()
-
-	paletted := image.NewPaletted(bounds, palette.WebSafe)
-	draw.FloydSteinberg.Draw(paletted, bounds, img, bounds.Min)
-
-	return paletted
-}
-
-func NewBufferedWriter() *bufio.Writer {
-	return bufio.NewWriterSize(os.Stdout, 64*1024) // 64 KB buffer
-}
-
-func detect_cap(fallback string) (iterm bool, kitty bool, sixel bool) {
-	isKittyCapable := rasterm.IsKittyCapable()
-	isItermCapable := rasterm.IsItermCapable()
-	isSixelCapable := false
-
-	if !isItermCapable && !isKittyCapable && fallback != "sixel" {
-		isSixelCapable, _ = rasterm.IsSixelCapable()
+	placement, errPlace := render.ParsePlace(place)
+	if errPlace != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", errPlace)
+		return
 	}
+	regionRect, errRegion := render.ParseRegion(region)
+	if errRegion != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", errRegion)
+		return
+	}
+	flipMode, errFlip := render.ParseFlip(flip)
+	if errFlip != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", errFlip)
+		return
+	}
+	background, errBg := render.ParseBackground(bg)
+	if errBg != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", errBg)
+		return
+	}
+	passthroughMode, errPassthrough := render.ParsePassthrough(passthrough)
+	if errPassthrough != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", errPassthrough)
+		return
+	}
+	config, errConfig := load_config(get_config_path())
+	if errConfig != nil {
+		fmt.Fprintf(os.Stderr, "Error reading config: %v\n", errConfig)
+		return
+	}
+	converterOrder := config.Converters
+	if converters != "" {
+		converterOrder = strings.Split(converters, ",")
+	}
+	cacheMaxBytes, errCacheMax := parse_size(cacheMax)
+	if errCacheMax != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", errCacheMax)
+		return
+	}
+	imgPath := flag.Args()[0]
 
-	if !isKittyCapable && !isItermCapable && !isSixelCapable {
-		switch strings.ToLower(fallback) {
-		case "kitty":
-			isKittyCapable = true
-		case "iterm":
-			isItermCapable = true
-		case "sixel":
-			isSixelCapable = true
+	opts := render.Options{
+		Width:        width,
+		Height:       height,
+		ResizeMode:   render.ParseResizeMethod(resizeMode),
+		Protocol:     proto,
+		Fallback:     fallbackProto,
+		Center:       center,
+		Align:        alignment,
+		Place:        placement,
+		Cache:        cache,
+		CacheMax:     cacheMaxBytes,
+		ScreenPx:     screenSizePx,
+		ScreenCell:   screenSizeCell,
+		Scale:        scale,
+		AutoRotate:   !noAutorotate,
+		Region:       regionRect,
+		Rotate:       rotate,
+		Flip:         flipMode,
+		Adjust:       adjustments,
+		AutoInvert:   autoInvert,
+		Background:   background,
+		Pages:        pages,
+		PageLayout:   render.ParsePageLayout(pageLayout),
+		Converters:   converterOrder,
+		Colors:       colors,
+		TextColor:    textColor,
+		Dither:       ditherAlgo,
+		Loop:         loop,
+		Passthrough:  passthroughMode,
+		QueryTimeout: queryTimeout,
+		Placeholder:  placeholder,
+		ImageID:      uint32(imageId),
+		PlacementID:  uint32(placementId),
+	}
+	switch report {
+	case "":
+	case "json":
+		opts.Report = func(r render.Report) {
+			out := os.NewFile(uintptr(reportFd), "report")
+			if out == nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid report fd %d\n", reportFd)
+				return
+			}
+			if err := json.NewEncoder(out).Encode(r); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+			}
 		}
+	default:
+		fmt.Fprintf(os.Stderr, "Error: invalid report '%s'. Must be json\n", report)
+		return
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	err := render.Render(ctx, os.Stdout, imgPath, opts)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintln(os.Stderr, err)
+		return
 	}
-
-	return isItermCapable, isKittyCapable, isSixelCapable
 }
 
 func determineType(value string) string {
@@ -216,6 +310,9 @@ func determineType(value string) string {
 	if valueLower == "true" || valueLower == "false" {
 		return "bool"
 	}
+	if _, err := strconv.Atoi(value); err == nil {
+		return "int"
+	}
 
 	return "string"
 }
@@ -0,0 +1,147 @@
+package render
+
+import (
+  "fmt"
+  "image"
+  "image/draw"
+  "math"
+  "strconv"
+  "strings"
+)
+
+type AdjustKind string
+
+const (
+  // Brightness adds Amount percent of white, -100 is black
+  Brightness AdjustKind = "brightness"
+  // Contrast stretches the colors away from middle gray by Amount percent, -100 is flat gray
+  Contrast AdjustKind = "contrast"
+  // Gamma above 1 brightens the midtones and below 1 darkens them
+  Gamma AdjustKind = "gamma"
+  // Saturation moves the colors away from their gray by Amount percent, -100 is grayscale
+  Saturation AdjustKind = "saturation"
+  // Grayscale and Invert take no Amount
+  Grayscale AdjustKind = "grayscale"
+  Invert    AdjustKind = "invert"
+)
+
+// Adjustment is one step of the color adjustments, which are applied in order
+type Adjustment struct {
+  Kind   AdjustKind
+  Amount float64
+}
+
+// ParseAdjustment maps a user supplied adjustment and its amount to an Adjustment,
+// the amount is ignored for grayscale and invert
+func ParseAdjustment(kind string, amount string) (Adjustment, error) {
+  a := Adjustment{Kind: AdjustKind(strings.ToLower(kind))}
+  switch a.Kind {
+  case Grayscale, Invert:
+    return a, nil
+  case Brightness, Contrast, Saturation, Gamma:
+  default:
+    return a, fmt.Errorf("invalid adjustment '%s'. Must be brightness, contrast, gamma, saturation, grayscale or invert", kind)
+  }
+
+  value, err := strconv.ParseFloat(amount, 64)
+  if err != nil {
+    return a, fmt.Errorf("invalid %s '%s'. Must be a number", kind, amount)
+  }
+  if a.Kind == Gamma && value <= 0 {
+    return a, fmt.Errorf("invalid gamma '%s'. Must be above 0", amount)
+  }
+  if a.Kind != Gamma && value < -100 {
+    return a, fmt.Errorf("invalid %s '%s'. Must be at least -100", kind, amount)
+  }
+  a.Amount = value
+  return a, nil
+}
+
+// apply changes the rgb of one pixel, channels are 0..1 and not premultiplied
+func (a Adjustment) apply(rgb *[3]float64) {
+  switch a.Kind {
+  case Brightness:
+    for i := range rgb {
+      rgb[i] += a.Amount / 100
+    }
+  case Contrast:
+    for i := range rgb {
+      rgb[i] = (rgb[i]-0.5)*(1+a.Amount/100) + 0.5
+    }
+  case Gamma:
+    for i := range rgb {
+      rgb[i] = math.Pow(max(rgb[i], 0), 1/a.Amount)
+    }
+  case Saturation:
+    gray := luma(rgb)
+    for i := range rgb {
+      rgb[i] = gray + (rgb[i]-gray)*(1+a.Amount/100)
+    }
+  case Grayscale:
+    gray := luma(rgb)
+    rgb[0], rgb[1], rgb[2] = gray, gray, gray
+  case Invert:
+    for i := range rgb {
+      rgb[i] = 1 - rgb[i]
+    }
+  }
+  for i := range rgb {
+    rgb[i] = min(max(rgb[i], 0), 1)
+  }
+}
+
+// luma is the rec. 709 brightness, the same weights luminance uses
+func luma(rgb *[3]float64) float64 {
+  return 0.2126*rgb[0] + 0.7152*rgb[1] + 0.0722*rgb[2]
+}
+
+// adjust_image applies the adjustments to every pixel of img, alpha is left as is
+func adjust_image(img image.Image, adjustments []Adjustment) image.Image {
+  if len(adjustments) == 0 {
+    return img
+  }
+  bounds := img.Bounds()
+  dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+  draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+
+  for i := 0; i < len(dst.Pix); i += 4 {
+    pix := dst.Pix[i : i+4]
+    if pix[3] == 0 {
+      continue
+    }
+    rgb := [3]float64{float64(pix[0]) / 255, float64(pix[1]) / 255, float64(pix[2]) / 255}
+    for _, a := range adjustments {
+      a.apply(&rgb)
+    }
+    for c := range rgb {
+      pix[c] = uint8(math.Round(rgb[c] * 255))
+    }
+  }
+  return dst
+}
+
+// white_background reports if most of the opaque pixels along the edges of img are close to white,
+// which is how diagrams, documents and screenshots of light themes look
+func white_background(img image.Image) bool {
+  bounds := img.Bounds()
+  var white, opaque int
+  count := func(x, y int) {
+    c := img.At(x, y)
+    if !is_opaque(c) {
+      return
+    }
+    opaque++
+    if luminance(c) > 0.85 {
+      white++
+    }
+  }
+  for x := bounds.Min.X; x < bounds.Max.X; x++ {
+    count(x, bounds.Min.Y)
+    count(x, bounds.Max.Y-1)
+  }
+  for y := bounds.Min.Y + 1; y < bounds.Max.Y-1; y++ {
+    count(bounds.Min.X, y)
+    count(bounds.Max.X-1, y)
+  }
+  return opaque > 0 && white*4 >= opaque*3
+}
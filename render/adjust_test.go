@@ -0,0 +1,207 @@
+package render
+
+import (
+  "bytes"
+  "context"
+  "image"
+  "image/color"
+  "image/png"
+  "strings"
+  "testing"
+)
+
+func TestParseAdjustment(t *testing.T) {
+  tests := []struct {
+    kind    string
+    amount  string
+    want    Adjustment
+    wantErr bool
+  }{
+    {"brightness", "20", Adjustment{Brightness, 20}, false},
+    {"Contrast", "-100", Adjustment{Contrast, -100}, false},
+    {"saturation", "150.5", Adjustment{Saturation, 150.5}, false},
+    {"gamma", "2.2", Adjustment{Gamma, 2.2}, false},
+    {"grayscale", "", Adjustment{Grayscale, 0}, false},
+    {"invert", "50", Adjustment{Invert, 0}, false},
+    {"brightness", "-101", Adjustment{}, true},
+    {"gamma", "0", Adjustment{}, true},
+    {"gamma", "-1", Adjustment{}, true},
+    {"contrast", "high", Adjustment{}, true},
+    {"sharpness", "10", Adjustment{}, true},
+  }
+  for _, tt := range tests {
+    t.Run(tt.kind+" "+tt.amount, func(t *testing.T) {
+      got, err := ParseAdjustment(tt.kind, tt.amount)
+      if tt.wantErr {
+        if err == nil {
+          t.Errorf("ParseAdjustment(%q, %q) = %v, want an error", tt.kind, tt.amount, got)
+        }
+        return
+      }
+      if err != nil || got != tt.want {
+        t.Errorf("ParseAdjustment(%q, %q) = %v, %v, want %v", tt.kind, tt.amount, got, err, tt.want)
+      }
+    })
+  }
+}
+
+func TestAdjustmentApply(t *testing.T) {
+  tests := []struct {
+    name string
+    a    Adjustment
+    in   [3]float64
+    want [3]float64
+  }{
+    {"brighter", Adjustment{Brightness, 50}, [3]float64{0.2, 0.4, 0.6}, [3]float64{0.7, 0.9, 1}},
+    {"black", Adjustment{Brightness, -100}, [3]float64{0.2, 0.4, 1}, [3]float64{0, 0, 0}},
+    {"more contrast", Adjustment{Contrast, 100}, [3]float64{0.25, 0.5, 0.6}, [3]float64{0, 0.5, 0.7}},
+    {"flat gray", Adjustment{Contrast, -100}, [3]float64{0, 0.3, 1}, [3]float64{0.5, 0.5, 0.5}},
+    {"gamma brightens", Adjustment{Gamma, 2}, [3]float64{0.25, 0, 1}, [3]float64{0.5, 0, 1}},
+    {"desaturated", Adjustment{Saturation, -100}, [3]float64{1, 0, 0}, [3]float64{0.2126, 0.2126, 0.2126}},
+    {"saturated", Adjustment{Saturation, 100}, [3]float64{0.6, 0.5, 0.5}, [3]float64{0.6787, 0.4787, 0.4787}},
+    {"grayscale", Adjustment{Kind: Grayscale}, [3]float64{0, 1, 0}, [3]float64{0.7152, 0.7152, 0.7152}},
+    {"invert", Adjustment{Kind: Invert}, [3]float64{0, 0.25, 1}, [3]float64{1, 0.75, 0}},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      rgb := tt.in
+      tt.a.apply(&rgb)
+      for i := range rgb {
+        if rgb[i] < tt.want[i]-0.001 || rgb[i] > tt.want[i]+0.001 {
+          t.Errorf("got %v, want %v", rgb, tt.want)
+          break
+        }
+      }
+    })
+  }
+}
+
+func TestAdjustImage(t *testing.T) {
+  img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+  img.Set(0, 0, color.NRGBA{0x40, 0x80, 0xc0, 0x80})
+  // transparent pixels are left alone
+  img.Set(1, 0, color.NRGBA{0x40, 0x80, 0xc0, 0})
+
+  // the steps are taken in order, so these two end up apart
+  tests := []struct {
+    name        string
+    adjustments []Adjustment
+    want        color.NRGBA
+  }{
+    {"invert then darken", []Adjustment{{Kind: Invert}, {Brightness, -25}}, color.NRGBA{0x7f, 0x3f, 0x00, 0x80}},
+    {"darken then invert", []Adjustment{{Brightness, -25}, {Kind: Invert}}, color.NRGBA{0xff, 0xbf, 0x7f, 0x80}},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      adjusted := adjust_image(img, tt.adjustments)
+      if got := color.NRGBAModel.Convert(adjusted.At(0, 0)); got != tt.want {
+        t.Errorf("got %v, want %v", got, tt.want)
+      }
+      if got := color.NRGBAModel.Convert(adjusted.At(1, 0)); got != (color.NRGBA{0x40, 0x80, 0xc0, 0}) {
+        t.Errorf("transparent pixel became %v", got)
+      }
+    })
+  }
+
+  if adjust_image(img, nil) != image.Image(img) {
+    t.Error("no adjustments copied the image")
+  }
+}
+
+// framed is a w x h image of fill with a one pixel border of edge
+func framed(w, h int, edge, fill color.Color) image.Image {
+  img := image.NewRGBA(image.Rect(0, 0, w, h))
+  for y := 0; y < h; y++ {
+    for x := 0; x < w; x++ {
+      if x == 0 || y == 0 || x == w-1 || y == h-1 {
+        img.Set(x, y, edge)
+      } else {
+        img.Set(x, y, fill)
+      }
+    }
+  }
+  return img
+}
+
+func TestWhiteBackground(t *testing.T) {
+  white := color.RGBA{0xf8, 0xf8, 0xf8, 0xff}
+  black := color.RGBA{0, 0, 0, 0xff}
+  tests := []struct {
+    name string
+    img  image.Image
+    want bool
+  }{
+    {"white edges", framed(8, 8, white, black), true},
+    {"dark edges", framed(8, 8, black, white), false},
+    {"transparent edges", framed(8, 8, color.RGBA{}, white), false},
+    {"mostly white edges", rows_image(2, black, white, white, white, white, white, white, white), true},
+    {"half white edges", cols_image(8, black, black, black, black, white, white, white, white), false},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      if got := white_background(tt.img); got != tt.want {
+        t.Errorf("got %v, want %v", got, tt.want)
+      }
+    })
+  }
+}
+
+func TestDarkBackgroundFromEnv(t *testing.T) {
+  // the terminal can't be asked in tests, so COLORFGBG decides
+  tests := []struct {
+    colorfgbg string
+    want      bool
+  }{
+    {"15;0", true},
+    {"0;15", false},
+    {"15;default;8", true},
+    {"0;7", false},
+    {"", false},
+  }
+  for _, tt := range tests {
+    t.Run(tt.colorfgbg, func(t *testing.T) {
+      t.Setenv("COLORFGBG", tt.colorfgbg)
+      if got := dark_background(DefaultQueryTimeout); got != tt.want {
+        t.Errorf("got %v, want %v", got, tt.want)
+      }
+    })
+  }
+}
+
+func TestRenderAdjusted(t *testing.T) {
+  t.Setenv("COLORTERM", "truecolor")
+  white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+  var page bytes.Buffer
+  if err := png.Encode(&page, flat_page(20, 30, white)); err != nil {
+    t.Fatal(err)
+  }
+  path := test_file(t, "page.png", page.Bytes())
+  tests := []struct {
+    name       string
+    adjust     []Adjustment
+    autoInvert bool
+    colorfgbg  string
+    want       string
+  }{
+    {"as is", nil, false, "15;0", "\x1b[38;2;255;255;255m"},
+    {"darkened", []Adjustment{{Brightness, -50}}, false, "15;0", "\x1b[38;2;128;128;128m"},
+    {"inverted on a dark terminal", nil, true, "15;0", "\x1b[38;2;0;0;0m"},
+    {"kept on a light terminal", nil, true, "0;15", "\x1b[38;2;255;255;255m"},
+    // inverting comes first
+    {"inverted and brightened", []Adjustment{{Brightness, 50}}, true, "15;0", "\x1b[38;2;128;128;128m"},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      t.Setenv("COLORFGBG", tt.colorfgbg)
+      opts := test_options(Blocks)
+      opts.Adjust, opts.AutoInvert = tt.adjust, tt.autoInvert
+      out := new(bytes.Buffer)
+      if err := Render(context.Background(), out, path, opts); err != nil {
+        t.Fatal(err)
+      }
+      if !strings.Contains(out.String(), tt.want) {
+        t.Errorf("output %q doesn't draw %q", out.String()[:min(out.Len(), 60)], tt.want)
+      }
+    })
+  }
+}
@@ -0,0 +1,310 @@
+package render
+
+import (
+  "bufio"
+  "bytes"
+  "context"
+  "crypto/rand"
+  "encoding/base64"
+  "encoding/binary"
+  "fmt"
+  "image"
+  "image/draw"
+  "image/gif"
+  "image/png"
+  "io"
+  "strings"
+  "time"
+
+  "github.com/BourgeoisBear/rasterm"
+)
+
+const (
+  // LoopGif plays the animation as many times as the gif itself asks for
+  LoopGif = 0
+  // LoopForever plays the animation until it is interrupted
+  LoopForever = -1
+)
+
+// browsers treat a 0 delay as 100ms, so do we
+const defaultFrameDelay = 100 * time.Millisecond
+
+type Animation struct {
+  Frames []image.Image
+  Delays []time.Duration
+  // LoopCount as stored in the gif, 0 loops forever, -1 plays once
+  LoopCount int
+}
+
+// plays returns how many times the animation should be played, 0 meaning forever
+func (a *Animation) plays(loop int) int {
+  if loop > 0 {
+    return loop
+  }
+  if loop < 0 {
+    return 0
+  }
+  switch {
+  case a.LoopCount == 0:
+    return 0
+  case a.LoopCount < 0:
+    return 1
+  default:
+    return a.LoopCount + 1
+  }
+}
+
+func read_gif(in input) (*gif.GIF, error) {
+  r, err := in.open()
+  if err != nil {
+    return nil, err
+  }
+  defer r.Close()
+
+  g, err := gif.DecodeAll(r)
+  if err != nil {
+    return nil, fmt.Errorf("Error decoding .gif: %v", err)
+  }
+  return g, nil
+}
+
+// composites the gif frames onto a canvas the size of the gif,
+// honoring the disposal method of each frame
+func composite_gif(g *gif.GIF) []image.Image {
+  bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+  if bounds.Empty() {
+    bounds = g.Image[0].Bounds()
+  }
+  canvas := image.NewRGBA(bounds)
+  frames := make([]image.Image, 0, len(g.Image))
+
+  for i, frame := range g.Image {
+    var disposal byte
+    if i < len(g.Disposal) {
+      disposal = g.Disposal[i]
+    }
+    var previous []byte
+    if disposal == gif.DisposalPrevious {
+      previous = append([]byte(nil), canvas.Pix...)
+    }
+
+    draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+    snapshot := image.NewRGBA(bounds)
+    copy(snapshot.Pix, canvas.Pix)
+    frames = append(frames, snapshot)
+
+    switch disposal {
+    case gif.DisposalBackground:
+      draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+    case gif.DisposalPrevious:
+      copy(canvas.Pix, previous)
+    }
+  }
+
+  return frames
+}
+
+// get_animation returns the transformed and resized frames of an animated gif,
+// or nil when in isn't one
+func get_animation(ctx context.Context, in input, widthDm Dimension, heightDm Dimension, resizeMode ResizeMethod, t transform, sSize ScreenSize) (*Animation, error) {
+  if in.format != ".gif" {
+    return nil, nil
+  }
+  g, err := read_gif(in)
+  if err != nil {
+    return nil, err
+  }
+  if len(g.Image) < 2 {
+    return nil, nil
+  }
+
+  width, height := widthDm.GetPixel(sSize), heightDm.GetPixel(sSize)
+  anim := &Animation{LoopCount: g.LoopCount}
+  for i, frame := range composite_gif(g) {
+    if err := ctx.Err(); err != nil {
+      return nil, err
+    }
+    frame, err := t.apply(frame, sSize)
+    if err != nil {
+      return nil, err
+    }
+    resized, err := ResizeImage(frame, uint(width), uint(height), resizeMode)
+    if err != nil {
+      return nil, err
+    }
+    delay := defaultFrameDelay
+    if i < len(g.Delay) && g.Delay[i] > 0 {
+      delay = time.Duration(g.Delay[i]) * 10 * time.Millisecond
+    }
+    anim.Frames = append(anim.Frames, resized)
+    anim.Delays = append(anim.Delays, delay)
+  }
+
+  return anim, nil
+}
+
+// picks a random non zero id for the kitty image
+func new_image_id() uint32 {
+  var buf [4]byte
+  rand.Read(buf[:])
+  id := binary.BigEndian.Uint32(buf[:]) & 0x7fffffff
+  if id == 0 {
+    id = 1
+  }
+  return id
+}
+
+// writes the png encoded img as a chunked kitty command, header holds the control keys
+func kitty_write_chunked(out io.Writer, header string, img image.Image) error {
+  pBuf := new(bytes.Buffer)
+  if err := png.Encode(pBuf, img); err != nil {
+    return err
+  }
+  payload := base64.StdEncoding.EncodeToString(pBuf.Bytes())
+
+  const chunkSize = 4096
+  first := true
+  for {
+    chunk := payload
+    more := 0
+    if len(chunk) > chunkSize {
+      chunk = chunk[:chunkSize]
+      more = 1
+    }
+    payload = payload[len(chunk):]
+
+    var err error
+    if first {
+      _, err = fmt.Fprintf(out, "%s,m=%d;%s%s", strings.TrimSuffix(header, ";"), more, chunk, rasterm.KITTY_IMG_FTR)
+      first = false
+    } else {
+      _, err = fmt.Fprintf(out, "%sm=%d;%s%s", rasterm.KITTY_IMG_HDR, more, chunk, rasterm.KITTY_IMG_FTR)
+    }
+    if err != nil {
+      return err
+    }
+    if more == 0 {
+      return nil
+    }
+  }
+}
+
+// transmits and displays img at the cursor. q=2 keeps the terminal from answering,
+// once the image has an id kitty would otherwise reply with OK into the tty
+func kitty_write_image(out io.Writer, img image.Image, opts rasterm.KittyImgOpts) error {
+  return kitty_write_chunked(out, opts.ToHeader("a=T", "f=100", "q=2"), img)
+}
+
+// sends all the frames with the kitty animation protocol and lets the terminal play them,
+// virtual places the image for unicode placeholders instead of at the cursor
+func kitty_write_animation(out io.Writer, anim *Animation, loop int, opts rasterm.KittyImgOpts, virtual bool) error {
+  if opts.ImageId == 0 {
+    opts.ImageId = new_image_id()
+  }
+  id := opts.ImageId
+
+  // root frame, transmitted and displayed like a normal image
+  keys := []string{"a=T", "f=100", "q=2"}
+  if virtual {
+    keys = append(keys, "U=1")
+  }
+  err := kitty_write_chunked(out, opts.ToHeader(keys...), anim.Frames[0])
+  if err != nil {
+    return err
+  }
+
+  for i, frame := range anim.Frames[1:] {
+    gap := anim.Delays[i+1].Milliseconds()
+    err := kitty_write_chunked(out, rasterm.KittyImgOpts{ImageId: id}.ToHeader("a=f", "f=100", "q=2", fmt.Sprintf("z=%d", gap)), frame)
+    if err != nil {
+      return err
+    }
+  }
+
+  // the root frame gap can only be set once it exists
+  _, err = fmt.Fprintf(out, "%sa=a,i=%d,r=1,z=%d,q=2%s", rasterm.KITTY_IMG_HDR, id, anim.Delays[0].Milliseconds(), rasterm.KITTY_IMG_FTR)
+  if err != nil {
+    return err
+  }
+
+  // v=1 loops forever, v=n plays n-1 times
+  loops := anim.plays(loop) + 1
+  if anim.plays(loop) == 0 {
+    loops = 1
+  }
+  _, err = fmt.Fprintf(out, "%sa=a,i=%d,s=3,v=%d,q=2%s", rasterm.KITTY_IMG_HDR, id, loops, rasterm.KITTY_IMG_FTR)
+  return err
+}
+
+// makes room for rows lines below the cursor so redrawing frames never scrolls
+// the screen, which would invalidate the saved cursor position
+func reserve_rows(out io.Writer, rows int) {
+  if rows <= 0 {
+    return
+  }
+  fmt.Fprint(out, strings.Repeat("\n", rows))
+  fmt.Fprintf(out, "\x1b[%dA", rows)
+}
+
+// plays the animation by redrawing every frame at the saved cursor position,
+// used for terminals that have no animation protocol of their own.
+// home moves the cursor back to the first frame instead, when the caller needs the saved position itself
+func play_frames(ctx context.Context, out *bufio.Writer, anim *Animation, loop int, home string, encode func(io.Writer, image.Image) error) error {
+  // encoding is the slow part, so do it once up front
+  payloads := make([][]byte, len(anim.Frames))
+  for i, frame := range anim.Frames {
+    if err := ctx.Err(); err != nil {
+      return nil
+    }
+    buf := new(bytes.Buffer)
+    if err := encode(buf, frame); err != nil {
+      return err
+    }
+    payloads[i] = buf.Bytes()
+  }
+
+  // hide the cursor while playing and restore it however we stop
+  out.WriteString("\x1b[?25l")
+  if home == "" {
+    out.WriteString("\x1b7")
+    home = "\x1b8"
+  }
+  defer func() {
+    out.WriteString("\x1b[?25h")
+    out.Flush()
+  }()
+
+  plays := anim.plays(loop)
+  timer := time.NewTimer(0)
+  <-timer.C
+  defer timer.Stop()
+  for played := 0; plays == 0 || played < plays; played++ {
+    for i, payload := range payloads {
+      if i > 0 || played > 0 {
+        // flushed on its own so a multiplexer has moved the cursor before the frame passes through
+        out.WriteString(home)
+        out.Flush()
+      }
+      if _, err := out.Write(payload); err != nil {
+        return err
+      }
+      if err := out.Flush(); err != nil {
+        return err
+      }
+
+      // the last frame stays on screen, no need to wait for it
+      if plays != 0 && played == plays-1 && i == len(payloads)-1 {
+        break
+      }
+      timer.Reset(anim.Delays[i])
+      select {
+      case <-ctx.Done():
+        // interrupted, leave the current frame on screen
+        return nil
+      case <-timer.C:
+      }
+    }
+  }
+
+  return nil
+}
@@ -0,0 +1,261 @@
+package render
+
+import (
+  "bufio"
+  "bytes"
+  "context"
+  "fmt"
+  "image"
+  "image/color/palette"
+  "image/gif"
+  "io"
+  "math/rand"
+  "regexp"
+  "strings"
+  "testing"
+  "time"
+
+  "github.com/BourgeoisBear/rasterm"
+)
+
+// test_gif encodes an animated gif of w x h frames, each a different flat color
+func test_gif(t *testing.T, w, h, frames int, loopCount int) []byte {
+  t.Helper()
+  g := &gif.GIF{LoopCount: loopCount}
+  for i := 0; i < frames; i++ {
+    frame := image.NewPaletted(image.Rect(0, 0, w, h), palette.Plan9)
+    for j := range frame.Pix {
+      frame.Pix[j] = uint8(i * 40)
+    }
+    g.Image = append(g.Image, frame)
+    g.Delay = append(g.Delay, 10*(i+1))
+  }
+  buf := new(bytes.Buffer)
+  if err := gif.EncodeAll(buf, g); err != nil {
+    t.Fatal(err)
+  }
+  return buf.Bytes()
+}
+
+var kitty_command = regexp.MustCompile("\x1b_G([^;\x1b]*)")
+
+// kitty_commands returns the control keys of every kitty command in out
+func kitty_commands(out string) []map[string]string {
+  var cmds []map[string]string
+  for _, m := range kitty_command.FindAllStringSubmatch(out, -1) {
+    keys := map[string]string{}
+    for _, kv := range strings.Split(m[1], ",") {
+      k, v, _ := strings.Cut(kv, "=")
+      keys[k] = v
+    }
+    cmds = append(cmds, keys)
+  }
+  return cmds
+}
+
+func TestPlays(t *testing.T) {
+  tests := []struct {
+    name      string
+    loop      int
+    loopCount int
+    want      int
+  }{
+    {"gif loops forever", LoopGif, 0, 0},
+    {"gif plays once", LoopGif, -1, 1},
+    {"gif loops twice", LoopGif, 2, 3},
+    {"forever overrides the gif", LoopForever, -1, 0},
+    {"count overrides the gif", 3, 0, 3},
+    {"once", 1, 5, 1},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      anim := &Animation{LoopCount: tt.loopCount}
+      if got := anim.plays(tt.loop); got != tt.want {
+        t.Errorf("plays(%d) with LoopCount %d = %d, want %d", tt.loop, tt.loopCount, got, tt.want)
+      }
+    })
+  }
+}
+
+func TestKittyWriteAnimation(t *testing.T) {
+  anim := &Animation{
+    Frames: []image.Image{test_image(4, 4), test_image(4, 4), test_image(4, 4)},
+    Delays: []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond},
+  }
+  out := new(bytes.Buffer)
+  if err := kitty_write_animation(out, anim, LoopGif, rasterm.KittyImgOpts{ImageId: 7}, false); err != nil {
+    t.Fatal(err)
+  }
+
+  want := []map[string]string{
+    {"a": "T", "f": "100", "i": "7", "m": "0", "q": "2"},
+    {"a": "f", "f": "100", "i": "7", "m": "0", "q": "2", "z": "20"},
+    {"a": "f", "f": "100", "i": "7", "m": "0", "q": "2", "z": "30"},
+    {"a": "a", "i": "7", "r": "1", "z": "10", "q": "2"},
+    {"a": "a", "i": "7", "s": "3", "v": "1", "q": "2"},
+  }
+  got := kitty_commands(out.String())
+  if len(got) != len(want) {
+    t.Fatalf("got %d commands %v, want %d", len(got), got, len(want))
+  }
+  for i := range want {
+    if len(got[i]) != len(want[i]) {
+      t.Errorf("command %d is %v, want %v", i, got[i], want[i])
+      continue
+    }
+    for k, v := range want[i] {
+      if got[i][k] != v {
+        t.Errorf("command %d is %v, want %v", i, got[i], want[i])
+        break
+      }
+    }
+  }
+}
+
+func TestKittyAnimationLoops(t *testing.T) {
+  tests := []struct {
+    name      string
+    loop      int
+    loopCount int
+    // the v= key, 1 loops forever and n plays n-1 times
+    want string
+  }{
+    {"gif loops forever", LoopGif, 0, "1"},
+    {"gif plays once", LoopGif, -1, "2"},
+    {"gif loops twice", LoopGif, 2, "4"},
+    {"forever", LoopForever, -1, "1"},
+    {"once", 1, 0, "2"},
+    {"three times", 3, 0, "4"},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      anim := &Animation{
+        Frames:    []image.Image{test_image(2, 2), test_image(2, 2)},
+        Delays:    []time.Duration{defaultFrameDelay, defaultFrameDelay},
+        LoopCount: tt.loopCount,
+      }
+      out := new(bytes.Buffer)
+      if err := kitty_write_animation(out, anim, tt.loop, rasterm.KittyImgOpts{ImageId: 1}, false); err != nil {
+        t.Fatal(err)
+      }
+      cmds := kitty_commands(out.String())
+      if got := cmds[len(cmds)-1]["v"]; got != tt.want {
+        t.Errorf("v=%s, want v=%s", got, tt.want)
+      }
+    })
+  }
+}
+
+func TestKittyWriteChunked(t *testing.T) {
+  // noise doesn't compress, so the png needs several chunks
+  img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+  rand.New(rand.NewSource(1)).Read(img.Pix)
+  out := new(bytes.Buffer)
+  if err := kitty_write_chunked(out, rasterm.KittyImgOpts{ImageId: 3}.ToHeader("a=f", "q=2"), img); err != nil {
+    t.Fatal(err)
+  }
+
+  cmds := kitty_commands(out.String())
+  if len(cmds) < 3 {
+    t.Fatalf("got %d chunks, want several", len(cmds))
+  }
+  if cmds[0]["a"] != "f" || cmds[0]["i"] != "3" {
+    t.Errorf("first chunk %v lost the header", cmds[0])
+  }
+  for i, cmd := range cmds {
+    more := "1"
+    if i == len(cmds)-1 {
+      more = "0"
+    }
+    if cmd["m"] != more {
+      t.Errorf("chunk %d has m=%s, want m=%s", i, cmd["m"], more)
+    }
+    if i > 0 && len(cmd) != 1 {
+      t.Errorf("chunk %d repeats keys %v", i, cmd)
+    }
+  }
+}
+
+func TestRenderAnimation(t *testing.T) {
+  path := test_file(t, "anim.gif", test_gif(t, 8, 8, 3, 0))
+  out := new(bytes.Buffer)
+  if err := Render(context.Background(), out, path, test_options(Kitty)); err != nil {
+    t.Fatal(err)
+  }
+  var actions []string
+  for _, cmd := range kitty_commands(out.String()) {
+    actions = append(actions, cmd["a"])
+  }
+  if got, want := strings.Join(actions, ","), "T,f,f,a,a"; got != want {
+    t.Errorf("actions %s, want %s", got, want)
+  }
+}
+
+// frame_sizes encodes a frame as its width, so tests can tell frames apart
+func frame_sizes(out io.Writer, frame image.Image) error {
+  _, err := fmt.Fprintf(out, "<%d>", frame.Bounds().Dx())
+  return err
+}
+
+func TestPlayFrames(t *testing.T) {
+  anim := &Animation{
+    Frames:    []image.Image{test_image(1, 1), test_image(2, 1), test_image(3, 1)},
+    Delays:    []time.Duration{time.Millisecond, time.Millisecond, time.Millisecond},
+    LoopCount: -1,
+  }
+  tests := []struct {
+    name string
+    loop int
+    home string
+    want string
+  }{
+    {"gif plays once", LoopGif, "", "\x1b[?25l\x1b7<1>\x1b8<2>\x1b8<3>\x1b[?25h"},
+    {"twice", 2, "", "\x1b[?25l\x1b7<1>\x1b8<2>\x1b8<3>\x1b8<1>\x1b8<2>\x1b8<3>\x1b[?25h"},
+    // the saved cursor is left to the caller
+    {"home", LoopGif, "\r\x1b[3d", "\x1b[?25l<1>\r\x1b[3d<2>\r\x1b[3d<3>\x1b[?25h"},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      out := new(bytes.Buffer)
+      if err := play_frames(context.Background(), bufio.NewWriter(out), anim, tt.loop, tt.home, frame_sizes); err != nil {
+        t.Fatal(err)
+      }
+      if out.String() != tt.want {
+        t.Errorf("got %q, want %q", out.String(), tt.want)
+      }
+    })
+  }
+}
+
+func TestPlayFramesInterrupted(t *testing.T) {
+  anim := &Animation{
+    Frames: []image.Image{test_image(1, 1), test_image(2, 1)},
+    Delays: []time.Duration{time.Millisecond, time.Millisecond},
+  }
+  ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+  defer cancel()
+  out := new(bytes.Buffer)
+  // loops forever until the context ends
+  if err := play_frames(ctx, bufio.NewWriter(out), anim, LoopForever, "", frame_sizes); err != nil {
+    t.Fatal(err)
+  }
+  if !strings.HasPrefix(out.String(), "\x1b[?25l\x1b7<1>\x1b8<2>\x1b8<1>") {
+    t.Errorf("frames weren't redrawn in place: %q", out.String())
+  }
+  if !strings.HasSuffix(out.String(), "\x1b[?25h") {
+    t.Errorf("cursor wasn't shown again: %q", out.String())
+  }
+}
+
+func TestReserveRows(t *testing.T) {
+  out := new(bytes.Buffer)
+  reserve_rows(out, 3)
+  if got, want := out.String(), "\n\n\n\x1b[3A"; got != want {
+    t.Errorf("got %q, want %q", got, want)
+  }
+  out.Reset()
+  reserve_rows(out, 0)
+  if out.Len() != 0 {
+    t.Errorf("reserved rows for nothing: %q", out.String())
+  }
+}
@@ -1,7 +1,6 @@
-package main
+package render
 
 import (
-  "bufio"
   "fmt"
   "os"
   "regexp"
@@ -32,6 +31,11 @@ type Dimension struct {
   direction DimensionDirection
 }
 
+// NewDimension creates a Dimension of value in the given unit
+func NewDimension(value int, kind DimensionType) Dimension {
+  return Dimension{value: value, kind: kind}
+}
+
 type ScreenSize struct {
   widthPx    int
   heightPx   int
@@ -39,48 +43,85 @@ type ScreenSize struct {
   heightCell int
 }
 
-func get_size_osc() (int, int, error) {
-  response, err := queryTerminal("\x1b[14t")
-  if err != nil {
-    return 0, 0, err
-  }
-
+// get_size_osc reads the size of the text area in px from the reply to \x1b[14t
+func get_size_osc(replies []reply) (int, int, error) {
   //\x1b[4;680;1550t
-  parts := strings.Split(response, ";")
-  height, _ := strconv.Atoi(parts[1])
-  width, _ := strconv.Atoi(strings.Replace(parts[2], "t", "", 1))
-
-  return width, height, nil
+  return size_reply(replies, "4;")
 }
 
-func get_size_cells(cellHandler *string) (int, int, error) {
-  response, err := queryTerminal("\x1b[18t")
+// get_size_cells reads the size of the text area in cells from the reply to \x1b[18t,
+// asking the tty driver when the terminal didn't answer
+func get_size_cells(replies []reply, cellHandler *string) (int, int, error) {
+  //\x1b[8;36;172t
+  width, height, err := size_reply(replies, "8;")
   if err != nil {
     fd := int(os.Stderr.Fd())
     widthCell, heightCell, err := term.GetSize(fd)
     *cellHandler = "go term"
     return widthCell, heightCell, err
   }
-
-  //[8;36;172t
-  parts := strings.Split(response, ";")
-  height, _ := strconv.Atoi(parts[1])
-  width, _ := strconv.Atoi(strings.Replace(parts[2], "t", "", 1))
   *cellHandler = "osc"
 
   return width, height, nil
 }
 
-func (s *ScreenSize) query(fallbackPx string, fallbackCell string, scale string) {
+// size_reply reads the <prefix><height>;<width>t reply of a window size query
+func size_reply(replies []reply, prefix string) (int, int, error) {
+  parts, ok := find_csi(replies, prefix, 't')
+  if !ok || len(parts) < 3 {
+    return 0, 0, fmt.Errorf("no window size response")
+  }
+  height, errH := strconv.Atoi(parts[1])
+  width, errW := strconv.Atoi(parts[2])
+  if errH != nil || errW != nil || width <= 0 || height <= 0 {
+    return 0, 0, fmt.Errorf("unexpected size response: %q", parts)
+  }
+  return width, height, nil
+}
+
+// asks the terminal how many sixel color registers it has, using XTSMGRAPHICS
+func get_sixel_registers(passthrough Passthrough, timeout time.Duration) (int, error) {
+  replies, err := query_terminal(passthrough, timeout, "\x1b[?1;1;0S")
+  //\x1b[?1;0;256S
+  parts, ok := find_csi(replies, "?1;", 'S')
+  if !ok {
+    return 0, fmt.Errorf("no color registers response: %v", err)
+  }
+  if len(parts) < 3 || parts[1] != "0" {
+    return 0, fmt.Errorf("terminal can't report its color registers")
+  }
+  return strconv.Atoi(parts[2])
+}
+
+// size_parts splits a WxH size, or def when size is empty or only has one side
+func size_parts(size string, def string) []string {
+  parts := strings.Split(size, "x")
+  if len(parts) < 2 {
+    return strings.Split(def, "x")
+  }
+  return parts
+}
+
+func (s *ScreenSize) query(fallbackPx string, fallbackCell string, scale string, passthrough Passthrough, timeout time.Duration) {
   forcePx := strings.Contains(strings.ToLower(fallbackPx), "force")
   forceCell := strings.Contains(strings.ToLower(fallbackCell), "force")
   hanlderPx := ""
   handlerCell := ""
 
+  // px and cells are asked for in one round trip
+  var replies []reply
+  var err error
+  if !forcePx || !forceCell {
+    replies, err = query_terminal(NoPassthrough, timeout, "\x1b[14t", "\x1b[18t")
+    if err != nil {
+      logger.Write(fmt.Sprintf("size query: %v", err))
+    }
+  }
+
   // attempt to query px when not forced
   if !forcePx {
     var err error
-    s.widthPx, s.heightPx, err = get_size_osc()
+    s.widthPx, s.heightPx, err = get_size_osc(replies)
     hanlderPx = "osc"
     if err != nil {
       s.widthPx, s.heightPx = check_device_dims()
@@ -88,25 +129,33 @@ func (s *ScreenSize) query(fallbackPx string, fallbackCell string, scale string)
     }
   }
 
+  // forced or failed to query cells
+  s.widthCell, s.heightCell, err = get_size_cells(replies, &handlerCell)
+  if err != nil || forceCell || s.widthCell <= 0 || s.heightCell <= 0 {
+    parts := size_parts(fallbackCell, DefaultOptions().ScreenCell)
+    s.widthCell, _ = strconv.Atoi(parts[0])
+    s.heightCell, _ = strconv.Atoi(parts[1])
+    handlerCell = "fallback"
+  }
+
+  // a multiplexer knows its pane in cells only, the outer terminal knows how big a cell is
+  if s.widthPx == 0 && !forcePx && passthrough != NoPassthrough {
+    cellWidth, cellHeight, err := get_cell_size_passthrough(passthrough, timeout)
+    if err == nil {
+      s.widthPx, s.heightPx = cellWidth*s.widthCell, cellHeight*s.heightCell
+      hanlderPx = "passthrough"
+    }
+  }
+
   // forced or failed to query px
   if s.widthPx == 0 || forcePx {
-    parts := strings.Split(fallbackPx, "x")
+    parts := size_parts(fallbackPx, DefaultOptions().ScreenPx)
     s.widthPx, _ = strconv.Atoi(parts[0])
     s.heightPx, _ = strconv.Atoi(parts[1])
     hanlderPx = "fallback"
   }
 
-  var err error
-  // forced or failed to query cells
-  s.widthCell, s.heightCell, err = get_size_cells(&handlerCell)
-  if err != nil || forceCell {
-    parts := strings.Split(fallbackCell, "x")
-    s.widthCell, _ = strconv.Atoi(parts[0])
-    s.heightCell, _ = strconv.Atoi(parts[1])
-    handlerCell = "fallback"
-  }
-
-  parts := strings.Split(scale, "x")
+  parts := size_parts(scale, DefaultOptions().Scale)
   scale_x, _ := strconv.ParseFloat(parts[0], 32)
   scale_y, _ := strconv.ParseFloat(parts[1], 32)
 
@@ -177,33 +226,3 @@ func ParseDimension(input string) (Dimension, error) {
 
   return dimension, nil
 }
-
-// sends osc and waits max 200ms for the res
-func queryTerminal(escapeSeq string) (string, error) {
-  if !term.IsTerminal(int(os.Stderr.Fd())) {
-    return "", fmt.Errorf("stderr not connected to terminal")
-  }
-  if !term.IsTerminal(int(os.Stdin.Fd())) {
-    return "", fmt.Errorf("stdin not connected to terminal")
-  }
-
-  fd := int(os.Stdin.Fd())
-  clean_func := make_raw(fd)
-  defer clean_func()
-
-  fmt.Fprintf(os.Stderr, escapeSeq)
-
-  ch := make(chan string, 1)
-  go func() {
-    reader := bufio.NewReader(os.Stdin)
-    response, _ := reader.ReadString('t')
-    ch <- response
-  }()
-
-  select {
-  case response := <-ch:
-    return response, nil
-  case <-time.After(50 * time.Millisecond):
-    return "", fmt.Errorf("timeout waiting for terminal response")
-  }
-}
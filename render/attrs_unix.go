@@ -0,0 +1,71 @@
+//go:build linux || darwin
+
+package render
+
+import (
+  "errors"
+  "os"
+  "time"
+
+  "golang.org/x/sys/unix"
+  "golang.org/x/term"
+)
+
+// only reliable thing for linux at the moment
+func getIoCtlSize() (width, height int) {
+  ws, err := unix.IoctlGetWinsize(int(os.Stderr.Fd()), unix.TIOCGWINSZ)
+  if err != nil {
+    return 0, 0
+  }
+
+  return int(ws.Xpixel), int(ws.Ypixel)
+}
+
+func check_device_dims() (width, height int) {
+  width, height = getIoCtlSize()
+
+  return width, height
+}
+
+func make_raw(fd int) func() {
+  oldstate, _ := term.MakeRaw(fd)
+  return func() {
+    term.Restore(fd, oldstate)
+  }
+}
+
+// open_tty opens the controlling terminal for queries, it is there even when stdin is a pipe
+func open_tty() (in *os.File, out *os.File, close func(), err error) {
+  tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+  if err != nil {
+    return nil, nil, nil, err
+  }
+  return tty, tty, func() { tty.Close() }, nil
+}
+
+// read_tty waits for the terminal to send something until deadline, nothing is left
+// blocked on the tty once it returns
+func read_tty(in *os.File, buf []byte, deadline time.Time) (int, error) {
+  fd := int(in.Fd())
+  for {
+    timeout := time.Until(deadline)
+    if timeout <= 0 {
+      return 0, os.ErrDeadlineExceeded
+    }
+    // select rather than poll, macos can't poll ttys
+    var readable unix.FdSet
+    readable.Set(fd)
+    tv := unix.NsecToTimeval(timeout.Nanoseconds())
+    n, err := unix.Select(fd+1, &readable, nil, nil, &tv)
+    if errors.Is(err, unix.EINTR) {
+      continue
+    }
+    if err != nil {
+      return 0, err
+    }
+    if n == 0 {
+      return 0, os.ErrDeadlineExceeded
+    }
+    return unix.Read(fd, buf)
+  }
+}
@@ -0,0 +1,154 @@
+package render
+
+import (
+  "errors"
+  "os"
+  "syscall"
+  "time"
+  "unsafe"
+
+  "github.com/lxn/win"
+  "golang.org/x/sys/windows"
+  "golang.org/x/term"
+)
+
+// works everywhere
+func check_device_dims() (width, height int) {
+  hWnd := win.GetForegroundWindow()
+  if hWnd == 0 {
+    return 0, 0
+  }
+
+  // get client size
+  var rect win.RECT
+  if !win.GetClientRect(hWnd, &rect) {
+    return 0, 0
+  }
+
+  // get frame size
+  style := win.GetWindowLong(win.GetForegroundWindow(), win.GWL_STYLE)
+  frameRect := win.RECT{
+    Left:   0,
+    Right:  0,
+    Bottom: 0,
+    Top:    0,
+  }
+  win.AdjustWindowRect(&frameRect, uint32(style), false)
+  frame_height := frameRect.Bottom - frameRect.Top
+  frame_width := frameRect.Right - frameRect.Left
+
+  logicalWidth := int(rect.Right-rect.Left) - int(frame_width)
+  logicalHeight := int(rect.Bottom-rect.Top) - int(frame_height)
+
+  return logicalWidth, logicalHeight
+}
+
+var (
+  kernel32 = syscall.NewLazyDLL("kernel32.dll")
+
+  getConsoleMode   = kernel32.NewProc("GetConsoleMode")
+  setConsoleMode   = kernel32.NewProc("SetConsoleMode")
+  getStdHandle     = kernel32.NewProc("GetStdHandle")
+  peekConsoleInput = kernel32.NewProc("PeekConsoleInputW")
+  readConsoleInput = kernel32.NewProc("ReadConsoleInputW")
+)
+
+const (
+  STD_INPUT_HANDLE = -10
+
+  ENABLE_ECHO_INPUT             = 0x4
+  ENABLE_LINE_INPUT             = 0x2
+  ENABLE_PROCESSED_INPUT        = 0x1
+  ENABLE_WINDOW_INPUT           = 0x8
+  ENABLE_MOUSE_INPUT            = 0x10
+  ENABLE_VIRTUAL_TERMINAL_INPUT = 0x200
+
+  KEY_EVENT = 0x1
+)
+
+// inputRecord is INPUT_RECORD with the event read as a KEY_EVENT_RECORD,
+// which is the biggest member of the union
+type inputRecord struct {
+  eventType       uint16
+  _               uint16
+  keyDown         int32
+  repeatCount     uint16
+  virtualKeyCode  uint16
+  virtualScanCode uint16
+  char            uint16
+  controlKeyState uint32
+}
+
+func make_raw(fd int) func() {
+  // Convert fd to Windows handle
+  handle := syscall.Handle(fd)
+
+  // Get the current console mode
+  var originalMode uint32
+  getConsoleMode.Call(uintptr(handle), uintptr(unsafe.Pointer(&originalMode)))
+
+  // Set raw mode by disabling processing flags
+  rawMode := originalMode &^ (ENABLE_ECHO_INPUT |
+    ENABLE_LINE_INPUT |
+    ENABLE_MOUSE_INPUT |
+    ENABLE_WINDOW_INPUT |
+    ENABLE_PROCESSED_INPUT)
+
+  // Enable virtual terminal input
+  rawMode |= ENABLE_VIRTUAL_TERMINAL_INPUT
+
+  // Apply the new mode
+  setConsoleMode.Call(uintptr(handle), uintptr(rawMode))
+
+  // Return cleanup function
+  return func() {
+    setConsoleMode.Call(uintptr(handle), uintptr(originalMode))
+  }
+}
+
+// open_tty returns the console queries are written to and read from,
+// windows has no /dev/tty so stdin and stderr have to be the console
+func open_tty() (in *os.File, out *os.File, close func(), err error) {
+  if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stderr.Fd())) {
+    return nil, nil, nil, errors.New("stdin and stderr aren't the console")
+  }
+  return os.Stdin, os.Stderr, func() {}, nil
+}
+
+// read_tty waits for the console to send something until deadline, nothing is left
+// blocked on the console once it returns
+func read_tty(in *os.File, buf []byte, deadline time.Time) (int, error) {
+  handle := windows.Handle(in.Fd())
+  records := make([]inputRecord, 64)
+  for {
+    timeout := time.Until(deadline)
+    if timeout <= 0 {
+      return 0, os.ErrDeadlineExceeded
+    }
+    event, err := windows.WaitForSingleObject(handle, uint32(timeout.Milliseconds()))
+    if err != nil {
+      return 0, err
+    }
+    if event == uint32(windows.WAIT_TIMEOUT) {
+      return 0, os.ErrDeadlineExceeded
+    }
+
+    // focus, mouse and resize events also wake the wait but give Read nothing,
+    // so it is only called once there are characters to read
+    var n uint32
+    ok, _, err := peekConsoleInput.Call(uintptr(handle), uintptr(unsafe.Pointer(&records[0])), uintptr(len(records)), uintptr(unsafe.Pointer(&n)))
+    if ok == 0 {
+      return 0, err
+    }
+    for _, record := range records[:n] {
+      if record.eventType == KEY_EVENT && record.keyDown != 0 && record.char != 0 {
+        return in.Read(buf)
+      }
+    }
+    // none of them carries a character, drop them so the wait doesn't wake for them again
+    ok, _, err = readConsoleInput.Call(uintptr(handle), uintptr(unsafe.Pointer(&records[0])), uintptr(n), uintptr(unsafe.Pointer(&n)))
+    if ok == 0 {
+      return 0, err
+    }
+  }
+}
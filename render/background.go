@@ -0,0 +1,114 @@
+package render
+
+import (
+  "fmt"
+  "image"
+  "image/color"
+  "image/draw"
+  "strconv"
+  "strings"
+  "time"
+)
+
+// Background is what transparent pixels are drawn over, a #rrggbb color or one of the constants
+type Background string
+
+const (
+  // BackgroundTransparent keeps the transparency, kitty and iterm blend it themselves,
+  // sixel leaves the pixels undrawn and text leaves the cells empty
+  BackgroundTransparent Background = ""
+  // BackgroundCheckerboard draws the gray squares image editors show transparency with
+  BackgroundCheckerboard Background = "checkerboard"
+  // BackgroundTerminal asks the terminal for its background, transparent when it doesn't answer
+  BackgroundTerminal Background = "terminal"
+)
+
+// the size of a checkerboard square in px
+const checkerSize = 8
+
+// ParseBackground maps a user supplied background to a Background
+func ParseBackground(bg string) (Background, error) {
+  b := Background(strings.ToLower(bg))
+  switch b {
+  case "transparent":
+    return BackgroundTransparent, nil
+  case BackgroundTransparent, BackgroundCheckerboard, BackgroundTerminal:
+    return b, nil
+  }
+  if _, err := parse_hex_color(string(b)); err != nil {
+    return "", fmt.Errorf("invalid background '%s'. Must be #rrggbb, #rgb, transparent, checkerboard or terminal", bg)
+  }
+  return b, nil
+}
+
+// parse_hex_color reads #rrggbb or #rgb
+func parse_hex_color(hex string) (color.RGBA, error) {
+  hex = strings.TrimPrefix(hex, "#")
+  if len(hex) == 3 {
+    hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+  }
+  value, err := strconv.ParseUint(hex, 16, 32)
+  if err != nil || len(hex) != 6 {
+    return color.RGBA{}, fmt.Errorf("invalid color '%s'", hex)
+  }
+  return color.RGBA{uint8(value >> 16), uint8(value >> 8), uint8(value), 0xff}, nil
+}
+
+// backdrop returns the image transparent pixels are drawn over, nil to keep them transparent.
+// the terminal gets timeout to tell its background
+func (bg Background) backdrop(timeout time.Duration) image.Image {
+  switch bg {
+  case BackgroundTransparent:
+    return nil
+  case BackgroundCheckerboard:
+    return checkerboard{}
+  case BackgroundTerminal:
+    c := terminal_colors(timeout).bg
+    if c == nil {
+      logger.Write("terminal background unknown, keeping transparency")
+      return nil
+    }
+    return image.NewUniform(c)
+  }
+  c, _ := parse_hex_color(string(bg))
+  return image.NewUniform(c)
+}
+
+// checkerboard is an endless image of light and dark gray squares
+type checkerboard struct{}
+
+func (checkerboard) ColorModel() color.Model { return color.RGBAModel }
+func (checkerboard) Bounds() image.Rectangle {
+  return image.Rect(-1e9, -1e9, 1e9, 1e9)
+}
+func (checkerboard) At(x, y int) color.Color {
+  if (x/checkerSize+y/checkerSize)%2 == 0 {
+    return color.RGBA{0x99, 0x99, 0x99, 0xff}
+  }
+  return color.RGBA{0x66, 0x66, 0x66, 0xff}
+}
+
+// flatten draws img over backdrop, the result is opaque
+func flatten(img image.Image, backdrop image.Image) image.Image {
+  bounds := img.Bounds()
+  dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+  draw.Draw(dst, dst.Bounds(), backdrop, image.Point{}, draw.Src)
+  draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Over)
+  return dst
+}
+
+// has_transparency reports if any pixel of img is more transparent than opaque
+func has_transparency(img image.Image) bool {
+  if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+    return false
+  }
+  bounds := img.Bounds()
+  for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+    for x := bounds.Min.X; x < bounds.Max.X; x++ {
+      if !is_opaque(img.At(x, y)) {
+        return true
+      }
+    }
+  }
+  return false
+}
@@ -0,0 +1,211 @@
+package render
+
+import (
+  "bytes"
+  "context"
+  "image"
+  "image/color"
+  "image/png"
+  "strings"
+  "testing"
+)
+
+func TestParseBackground(t *testing.T) {
+  tests := []struct {
+    input   string
+    want    Background
+    wantErr bool
+  }{
+    {"", BackgroundTransparent, false},
+    {"transparent", BackgroundTransparent, false},
+    {"Checkerboard", BackgroundCheckerboard, false},
+    {"terminal", BackgroundTerminal, false},
+    {"#1E2029", "#1e2029", false},
+    {"#fff", "#fff", false},
+    {"1e2029", "1e2029", false},
+    {"#1e20", "", true},
+    {"#gggggg", "", true},
+    {"white", "", true},
+  }
+  for _, tt := range tests {
+    t.Run(tt.input, func(t *testing.T) {
+      got, err := ParseBackground(tt.input)
+      if tt.wantErr {
+        if err == nil {
+          t.Errorf("ParseBackground(%q) = %q, want an error", tt.input, got)
+        }
+        return
+      }
+      if err != nil || got != tt.want {
+        t.Errorf("ParseBackground(%q) = %q, %v, want %q", tt.input, got, err, tt.want)
+      }
+    })
+  }
+}
+
+func TestParseHexColor(t *testing.T) {
+  tests := []struct {
+    input   string
+    want    color.RGBA
+    wantErr bool
+  }{
+    {"#1e2029", color.RGBA{0x1e, 0x20, 0x29, 0xff}, false},
+    {"ffffff", color.RGBA{0xff, 0xff, 0xff, 0xff}, false},
+    {"#f80", color.RGBA{0xff, 0x88, 0x00, 0xff}, false},
+    {"#1e202", color.RGBA{}, true},
+    {"#1e20291", color.RGBA{}, true},
+    {"#-1e202", color.RGBA{}, true},
+    {"", color.RGBA{}, true},
+  }
+  for _, tt := range tests {
+    t.Run(tt.input, func(t *testing.T) {
+      got, err := parse_hex_color(tt.input)
+      if tt.wantErr {
+        if err == nil {
+          t.Errorf("parse_hex_color(%q) = %v, want an error", tt.input, got)
+        }
+        return
+      }
+      if err != nil || got != tt.want {
+        t.Errorf("parse_hex_color(%q) = %v, %v, want %v", tt.input, got, err, tt.want)
+      }
+    })
+  }
+}
+
+func TestFlatten(t *testing.T) {
+  img := image.NewNRGBA(image.Rect(2, 2, 5, 3))
+  img.Set(2, 2, color.NRGBA{0xff, 0, 0, 0xff})
+  img.Set(3, 2, color.NRGBA{0xff, 0, 0, 0x80})
+  // the third pixel is left transparent
+  flat := flatten(img, image.NewUniform(color.RGBA{0, 0, 0xff, 0xff}))
+
+  want := []color.RGBA{{0xff, 0, 0, 0xff}, {0x80, 0, 0x7f, 0xff}, {0, 0, 0xff, 0xff}}
+  if got := flat.Bounds(); got != image.Rect(0, 0, 3, 1) {
+    t.Fatalf("bounds %v, want it moved to the origin", got)
+  }
+  for x, c := range want {
+    if got := color.RGBAModel.Convert(flat.At(x, 0)); got != c {
+      t.Errorf("pixel %d is %v, want %v", x, got, c)
+    }
+  }
+}
+
+func TestCheckerboard(t *testing.T) {
+  light, dark := checkerboard{}.At(0, 0), checkerboard{}.At(checkerSize, 0)
+  if light == dark {
+    t.Fatal("neighbouring squares have the same color")
+  }
+  tests := []struct {
+    x, y int
+    want color.Color
+  }{
+    {checkerSize - 1, checkerSize - 1, light},
+    {0, checkerSize, dark},
+    {checkerSize, checkerSize, light},
+    {3 * checkerSize, 2 * checkerSize, dark},
+  }
+  for _, tt := range tests {
+    if got := (checkerboard{}).At(tt.x, tt.y); got != tt.want {
+      t.Errorf("%d,%d is %v, want %v", tt.x, tt.y, got, tt.want)
+    }
+  }
+}
+
+func TestHasTransparency(t *testing.T) {
+  tests := []struct {
+    name string
+    img  image.Image
+    want bool
+  }{
+    {"opaque", test_image(4, 4), false},
+    {"transparent pixel", rows_image(2, red, none), true},
+    {"mostly opaque", rows_image(1, color.NRGBA{0xff, 0, 0, 0xc0}), false},
+    {"mostly transparent", rows_image(1, color.NRGBA{0xff, 0, 0, 0x40}), true},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      if got := has_transparency(tt.img); got != tt.want {
+        t.Errorf("got %v, want %v", got, tt.want)
+      }
+    })
+  }
+}
+
+func TestConvertToPalettedKeepsTransparency(t *testing.T) {
+  img := rows_image(4, red, none, blue, none)
+  paletted := convertToPaletted(img, 16, FloydSteinberg)
+  transparent := uint8(len(paletted.Palette) - 1)
+  if _, _, _, a := paletted.Palette[transparent].RGBA(); a != 0 {
+    t.Fatalf("last palette entry %v isn't transparent", paletted.Palette[transparent])
+  }
+  for y, want := range []bool{false, true, false, true} {
+    for x := 0; x < 4; x++ {
+      if got := paletted.ColorIndexAt(x, y) == transparent; got != want {
+        t.Errorf("pixel %d,%d transparent %v, want %v", x, y, got, want)
+      }
+    }
+  }
+
+  // an opaque image gets all the colors
+  if paletted := convertToPaletted(rows_image(4, red, blue), 16, FloydSteinberg); len(paletted.Palette) != 2 {
+    t.Errorf("palette %v, want red and blue", paletted.Palette)
+  }
+}
+
+func TestQuantizeKeepsEdgeColors(t *testing.T) {
+  // a faint red edge is still red, premultiplied it would be near black
+  faint := color.NRGBA{0xff, 0, 0, 0x20}
+  p := color.Palette{color.RGBA{0, 0, 0, 0xff}, color.RGBA{0xff, 0, 0, 0xff}}
+  paletted := NoDither.quantize(rows_image(1, faint), p)
+  if got := paletted.ColorIndexAt(0, 0); got != 1 {
+    t.Errorf("faint red became %v", p[got])
+  }
+}
+
+func TestDecodeSVGIsTransparent(t *testing.T) {
+  svg := `<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><rect x="4" y="4" width="2" height="2" fill="red"/></svg>`
+  img, err := decodeSVG(strings.NewReader(svg), 10, 10)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if _, _, _, a := img.At(0, 0).RGBA(); a != 0 {
+    t.Errorf("background has alpha %d, want it transparent", a)
+  }
+  if _, _, _, a := img.At(5, 5).RGBA(); a == 0 {
+    t.Error("the drawing is transparent")
+  }
+}
+
+func TestRenderBackground(t *testing.T) {
+  t.Setenv("COLORTERM", "truecolor")
+  buf := new(bytes.Buffer)
+  if err := png.Encode(buf, rows_image(20, red, red, none, none)); err != nil {
+    t.Fatal(err)
+  }
+  path := test_file(t, "img.png", buf.Bytes())
+  tests := []struct {
+    name string
+    bg   Background
+    // if the bottom half of the cells is drawn, or left to the terminal
+    drawn bool
+  }{
+    {"transparent", BackgroundTransparent, false},
+    {"color", "#102030", true},
+    {"checkerboard", BackgroundCheckerboard, true},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      opts := test_options(Blocks)
+      opts.Width, opts.Height = NewDimension(20, Pixel), NewDimension(4, Pixel)
+      opts.Background = tt.bg
+      out := new(bytes.Buffer)
+      if err := Render(context.Background(), out, path, opts); err != nil {
+        t.Fatal(err)
+      }
+      if got := strings.Contains(out.String(), "\x1b[48;2;"); got != tt.drawn {
+        t.Errorf("background drawn %v, want %v: %q", got, tt.drawn, out.String())
+      }
+    })
+  }
+}
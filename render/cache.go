@@ -0,0 +1,339 @@
+package render
+
+import (
+  "bytes"
+  "encoding/binary"
+  "fmt"
+  "os"
+  "path/filepath"
+  "sort"
+  "strings"
+  "time"
+
+  "github.com/boltdb/bolt"
+)
+
+var bucket_name = []byte("documents")
+
+// holds the created and last accessed times of every entry in bucket_name
+var meta_bucket_name = []byte("documents_meta")
+
+// DefaultCacheMax is the size the cache is trimmed to when nothing else is configured
+const DefaultCacheMax = 256 << 20
+
+func get_db_loc() string {
+  cache_dir, _ := os.UserCacheDir()
+  path := filepath.Join(cache_dir, "ttyimg")
+  _ = os.MkdirAll(path, 0755)
+
+  return filepath.Join(path, "ttyimg_cache.db")
+}
+
+// CacheLocation returns the path of the cache database
+func CacheLocation() string {
+  return get_db_loc()
+}
+
+// opens the cache db and makes sure the buckets exist,
+// the caller is responsible for closing it
+func open_db() (*bolt.DB, error) {
+  db, err := bolt.Open(get_db_loc(), 0600, &bolt.Options{Timeout: time.Second})
+  if err != nil {
+    return nil, err
+  }
+  err = db.Update(func(tx *bolt.Tx) error {
+    if _, err := tx.CreateBucketIfNotExists(bucket_name); err != nil {
+      return err
+    }
+    _, err := tx.CreateBucketIfNotExists(meta_bucket_name)
+    return err
+  })
+  if err != nil {
+    db.Close()
+    return nil, err
+  }
+
+  return db, nil
+}
+
+// cache_key identifies a converted page of path by what is on disk right now and by the
+// converter, so a changed file never hits a stale entry. the page is stored at the resolution
+// the converter gave, every size is resized from it
+func cache_key(path string, page int, converter string) ([]byte, error) {
+  abs, err := filepath.Abs(path)
+  if err != nil {
+    return nil, err
+  }
+  info, err := os.Stat(abs)
+  if err != nil {
+    return nil, err
+  }
+
+  key := fmt.Sprintf("%s\x00%d\x00%d\x00page=%d\x00%s", abs, info.ModTime().UnixNano(), info.Size(), page, converter)
+  return []byte(key), nil
+}
+
+// key_identity returns the path, modification time and size part of a cache key
+func key_identity(key []byte) []byte {
+  end := 0
+  for i := 0; i < 3; i++ {
+    next := bytes.IndexByte(key[end:], 0)
+    if next < 0 {
+      return key
+    }
+    end += next + 1
+  }
+  return key[:end]
+}
+
+// key_path returns the path part of a cache key
+func key_path(key []byte) []byte {
+  if i := bytes.IndexByte(key, 0); i >= 0 {
+    return key[:i]
+  }
+  // keys from before the content identity was part of them
+  return key
+}
+
+func encode_meta(created, accessed time.Time) []byte {
+  buf := make([]byte, 16)
+  binary.BigEndian.PutUint64(buf[:8], uint64(created.UnixNano()))
+  binary.BigEndian.PutUint64(buf[8:], uint64(accessed.UnixNano()))
+  return buf
+}
+
+func decode_meta(buf []byte) (created, accessed time.Time) {
+  if len(buf) != 16 {
+    return
+  }
+  created = time.Unix(0, int64(binary.BigEndian.Uint64(buf[:8])))
+  accessed = time.Unix(0, int64(binary.BigEndian.Uint64(buf[8:])))
+  return
+}
+
+func cache_get(db *bolt.DB, key []byte) []byte {
+  var value []byte
+  db.Update(func(tx *bolt.Tx) error {
+    // bolt values are only valid for the life of the transaction
+    value = append([]byte(nil), tx.Bucket(bucket_name).Get(key)...)
+    if len(value) == 0 {
+      return nil
+    }
+    meta := tx.Bucket(meta_bucket_name)
+    created, _ := decode_meta(meta.Get(key))
+    now := time.Now()
+    if created.IsZero() {
+      created = now
+    }
+    return meta.Put(key, encode_meta(created, now))
+  })
+  if len(value) == 0 {
+    return nil
+  }
+  return value
+}
+
+// cache_put stores value under key, dropping the entries of other
+// versions of the same file since they can never be hit again,
+// then evicts the least recently used entries until the cache fits in max bytes
+func cache_put(db *bolt.DB, key []byte, value []byte, max int64) error {
+  path := key_path(key)
+  identity := key_identity(key)
+  return db.Update(func(tx *bolt.Tx) error {
+    bucket := tx.Bucket(bucket_name)
+    stale := [][]byte{}
+    prefix := append(append([]byte(nil), path...), 0)
+    c := bucket.Cursor()
+    for k, _ := c.Seek(path); k != nil && bytes.HasPrefix(k, path); k, _ = c.Next() {
+      // other pages of the same version are still valid
+      if bytes.HasPrefix(k, identity) {
+        continue
+      }
+      if bytes.Equal(k, path) || bytes.HasPrefix(k, prefix) {
+        stale = append(stale, append([]byte(nil), k...))
+      }
+    }
+    for _, k := range stale {
+      if err := delete_entry(tx, k); err != nil {
+        return err
+      }
+    }
+
+    if err := bucket.Put(key, value); err != nil {
+      return err
+    }
+    now := time.Now()
+    if err := tx.Bucket(meta_bucket_name).Put(key, encode_meta(now, now)); err != nil {
+      return err
+    }
+    if max <= 0 {
+      return nil
+    }
+    _, err := evict(tx, max, key)
+    return err
+  })
+}
+
+func delete_entry(tx *bolt.Tx, key []byte) error {
+  if err := tx.Bucket(bucket_name).Delete(key); err != nil {
+    return err
+  }
+  return tx.Bucket(meta_bucket_name).Delete(key)
+}
+
+type CacheEntry struct {
+  // Path of the cached file
+  Path string
+  // Params holds the modification time, size and conversion parameters the entry was made with
+  Params string
+  // Size of the cached image in bytes
+  Size int
+  // Created and Accessed are zero for entries written by older versions
+  Created  time.Time
+  Accessed time.Time
+
+  key []byte
+}
+
+// LastUsed is when the entry was last read or written, the time eviction goes by. zero when unknown
+func (e CacheEntry) LastUsed() time.Time {
+  if e.Accessed.IsZero() {
+    return e.Created
+  }
+  return e.Accessed
+}
+
+func list_entries(tx *bolt.Tx) []CacheEntry {
+  entries := []CacheEntry{}
+  meta := tx.Bucket(meta_bucket_name)
+  tx.Bucket(bucket_name).ForEach(func(k, v []byte) error {
+    entry := CacheEntry{Path: string(key_path(k)), Size: len(v), key: append([]byte(nil), k...)}
+    if len(entry.Path) < len(k) {
+      entry.Params = strings.ReplaceAll(string(k[len(entry.Path)+1:]), "\x00", " ")
+    }
+    if meta != nil {
+      entry.Created, entry.Accessed = decode_meta(meta.Get(k))
+    }
+    entries = append(entries, entry)
+    return nil
+  })
+  return entries
+}
+
+// evicts the least recently used entries, except keep, until the cache fits in max bytes
+func evict(tx *bolt.Tx, max int64, keep []byte) (int, error) {
+  entries := list_entries(tx)
+  var total int64
+  for _, entry := range entries {
+    total += int64(entry.Size)
+  }
+  if total <= max {
+    return 0, nil
+  }
+
+  sort.Slice(entries, func(i, j int) bool {
+    return entries[i].LastUsed().Before(entries[j].LastUsed())
+  })
+  removed := 0
+  for _, entry := range entries {
+    if total <= max {
+      break
+    }
+    if bytes.Equal(entry.key, keep) {
+      continue
+    }
+    if err := delete_entry(tx, entry.key); err != nil {
+      return removed, err
+    }
+    total -= int64(entry.Size)
+    removed++
+  }
+  logger.Write(fmt.Sprintf("cache evicted %d entries to fit in %d bytes", removed, max))
+  return removed, nil
+}
+
+// ListCache returns every entry of the cache, least recently used first
+func ListCache() ([]CacheEntry, error) {
+  db, err := open_db()
+  if err != nil {
+    return nil, err
+  }
+  defer db.Close()
+
+  var entries []CacheEntry
+  db.View(func(tx *bolt.Tx) error {
+    entries = list_entries(tx)
+    return nil
+  })
+  sort.Slice(entries, func(i, j int) bool {
+    return entries[i].LastUsed().Before(entries[j].LastUsed())
+  })
+  return entries, nil
+}
+
+// removes every entry matching, returning how many were removed
+func remove_entries(match func(CacheEntry) bool) (int, error) {
+  db, err := open_db()
+  if err != nil {
+    return 0, err
+  }
+  defer db.Close()
+
+  removed := 0
+  err = db.Update(func(tx *bolt.Tx) error {
+    for _, entry := range list_entries(tx) {
+      if !match(entry) {
+        continue
+      }
+      if err := delete_entry(tx, entry.key); err != nil {
+        return err
+      }
+      removed++
+    }
+    return nil
+  })
+  return removed, err
+}
+
+// PruneCache removes the entries that weren't used in the last olderThan,
+// entries with no recorded usage are always removed
+func PruneCache(olderThan time.Duration) (int, error) {
+  cutoff := time.Now().Add(-olderThan)
+  return remove_entries(func(entry CacheEntry) bool {
+    return entry.LastUsed().Before(cutoff)
+  })
+}
+
+// TrimCache evicts the least recently used entries until the cache fits in max bytes
+func TrimCache(max int64) (int, error) {
+  db, err := open_db()
+  if err != nil {
+    return 0, err
+  }
+  defer db.Close()
+
+  removed := 0
+  err = db.Update(func(tx *bolt.Tx) error {
+    removed, err = evict(tx, max, nil)
+    return err
+  })
+  return removed, err
+}
+
+// RemoveCached removes every entry of path
+func RemoveCached(path string) (int, error) {
+  abs, err := filepath.Abs(path)
+  if err != nil {
+    return 0, err
+  }
+  return remove_entries(func(entry CacheEntry) bool {
+    return entry.Path == abs
+  })
+}
+
+// ClearCache removes every entry
+func ClearCache() (int, error) {
+  return remove_entries(func(entry CacheEntry) bool {
+    return true
+  })
+}
@@ -0,0 +1,396 @@
+package render
+
+import (
+  "bytes"
+  "context"
+  "fmt"
+  "os"
+  "path/filepath"
+  "runtime"
+  "strings"
+  "testing"
+  "time"
+
+  "github.com/boltdb/bolt"
+)
+
+// with_cache points the cache at an empty database for the test
+func with_cache(t *testing.T) {
+  t.Helper()
+  dir := t.TempDir()
+  t.Setenv("XDG_CACHE_HOME", dir)
+  t.Setenv("HOME", dir)
+  t.Setenv("LocalAppData", dir)
+}
+
+// stub_libreoffice puts a libreoffice on PATH that converts any document to a w x h png,
+// it returns a func listing the --convert-to argument of every run
+func stub_libreoffice(t *testing.T, w, h int) func() []string {
+  t.Helper()
+  if runtime.GOOS == "windows" {
+    t.Skip("stub converters are shell scripts")
+  }
+  dir := t.TempDir()
+  png := filepath.Join(dir, "page.png")
+  if err := os.WriteFile(png, test_png(t, w, h), 0644); err != nil {
+    t.Fatal(err)
+  }
+  runs := filepath.Join(dir, "runs")
+  // called as --headless --convert-to <format> <path> --outdir <dir>
+  script := fmt.Sprintf("#!/bin/sh\necho \"$3\" >> %s\nname=$(basename \"$4\")\ncp %s \"$6/${name%%.*}.png\"\n", runs, png)
+  if err := os.WriteFile(filepath.Join(dir, "libreoffice"), []byte(script), 0755); err != nil {
+    t.Fatal(err)
+  }
+  t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+  return func() []string {
+    data, _ := os.ReadFile(runs)
+    return strings.Fields(string(data))
+  }
+}
+
+// cached_keys returns every key in the cache
+func cached_keys(t *testing.T) [][]byte {
+  t.Helper()
+  db, err := open_db()
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer db.Close()
+  var keys [][]byte
+  db.View(func(tx *bolt.Tx) error {
+    return tx.Bucket(bucket_name).ForEach(func(k, v []byte) error {
+      keys = append(keys, append([]byte(nil), k...))
+      return nil
+    })
+  })
+  return keys
+}
+
+func TestCacheKey(t *testing.T) {
+  doc := test_file(t, "doc.odt", []byte("first"))
+  key, err := cache_key(doc, 1, "libreoffice")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if again, _ := cache_key(doc, 1, "libreoffice"); !bytes.Equal(key, again) {
+    t.Errorf("same file gave keys %q and %q", key, again)
+  }
+  if page, _ := cache_key(doc, 2, "libreoffice"); bytes.Equal(key, page) {
+    t.Errorf("another page reused key %q", key)
+  }
+  if converted, _ := cache_key(doc, 1, "mutool"); bytes.Equal(key, converted) {
+    t.Errorf("another converter reused key %q", key)
+  }
+  abs, _ := filepath.Abs(doc)
+  if got := key_path(key); string(got) != abs {
+    t.Errorf("key_path = %q, want %q", got, abs)
+  }
+  // keys from before the file identity was part of them are the bare path
+  if got := key_path([]byte(abs)); string(got) != abs {
+    t.Errorf("key_path of an old key = %q, want %q", got, abs)
+  }
+  if _, err := cache_key(filepath.Join(t.TempDir(), "missing.odt"), 1, "libreoffice"); err == nil {
+    t.Error("keyed a missing file")
+  }
+}
+
+func TestCachedPageIgnoresSize(t *testing.T) {
+  with_cache(t)
+  png := stub_converter(t, "stub-cache", 30, 40, 1)
+  doc := filepath.Join(t.TempDir(), "doc.pdf")
+  if err := os.WriteFile(doc, []byte("%PDF-1.4\n"), 0644); err != nil {
+    t.Fatal(err)
+  }
+  db, err := open_db()
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer db.Close()
+
+  convert := func(width, height int) (int, int) {
+    t.Helper()
+    img, _, err := convert_page(context.Background(), db, doc, ".pdf", 1, width, height, []string{"stub-cache"}, 0)
+    if err != nil {
+      t.Fatal(err)
+    }
+    return img.Bounds().Dx(), img.Bounds().Dy()
+  }
+
+  if w, h := convert(10, 10); w != 30 || h != 40 {
+    t.Fatalf("converted page is %dx%d, want the full 30x40", w, h)
+  }
+  // a different page from the converter shows up only if the cache was missed
+  if err := os.WriteFile(png, test_png(t, 50, 60), 0644); err != nil {
+    t.Fatal(err)
+  }
+  if w, h := convert(300, 200); w != 30 || h != 40 {
+    t.Errorf("page at another size is %dx%d, want the cached 30x40", w, h)
+  }
+}
+
+func TestChangedDocumentMissesCache(t *testing.T) {
+  with_cache(t)
+  runs := stub_libreoffice(t, 30, 40)
+  doc := test_file(t, "doc.odt", []byte("first"))
+
+  convert := func() {
+    t.Helper()
+    img, exists, err := is_special_doc(context.Background(), file_input(doc), 10, 10, PageRange{1, 1}, Stack, nil, true, 0)
+    if err != nil || !exists || img == nil {
+      t.Fatalf("got %v, %v, %v", img, exists, err)
+    }
+  }
+
+  convert()
+  convert()
+  if len(runs()) != 1 {
+    t.Fatalf("converted %d times, want the second render cached", len(runs()))
+  }
+  oldKey, err := cache_key(doc, 1, "libreoffice")
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  // same size, new content and mtime
+  if err := os.WriteFile(doc, []byte("second"), 0644); err != nil {
+    t.Fatal(err)
+  }
+  later := time.Now().Add(time.Hour)
+  if err := os.Chtimes(doc, later, later); err != nil {
+    t.Fatal(err)
+  }
+  convert()
+  if len(runs()) != 2 {
+    t.Fatalf("converted %d times, want the changed file to miss the cache", len(runs()))
+  }
+
+  newKey, err := cache_key(doc, 1, "libreoffice")
+  if err != nil {
+    t.Fatal(err)
+  }
+  keys := cached_keys(t)
+  if len(keys) != 1 || !bytes.Equal(keys[0], newKey) {
+    t.Errorf("cache holds %q, want only %q", keys, newKey)
+  }
+  for _, k := range keys {
+    if bytes.Equal(k, oldKey) {
+      t.Errorf("old key %q is still cached", oldKey)
+    }
+  }
+}
+
+func TestCachePutDropsOlderVersions(t *testing.T) {
+  with_cache(t)
+  db, err := open_db()
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer db.Close()
+
+  db.Update(func(tx *bolt.Tx) error {
+    b := tx.Bucket(bucket_name)
+    for _, key := range []string{
+      // from before the file identity was part of the key
+      "/docs/a.pdf",
+      "/docs/a.pdf\x001\x002\x0010x10",
+      "/docs/a.pdf\x001\x002\x0020x20",
+      // another page of the version being put
+      "/docs/a.pdf\x003\x004\x0010x10\x00page=2",
+      // shares a prefix with the path but is another file
+      "/docs/a.pdfx\x001\x002\x0010x10",
+      "/docs/b.pdf\x001\x002\x0010x10",
+    } {
+      if err := b.Put([]byte(key), []byte("old")); err != nil {
+        return err
+      }
+    }
+    return nil
+  })
+
+  newKey := []byte("/docs/a.pdf\x003\x004\x0010x10\x00page=1")
+  if err := cache_put(db, newKey, []byte("new"), 0); err != nil {
+    t.Fatal(err)
+  }
+
+  want := map[string]string{
+    string(newKey): "new",
+    "/docs/a.pdf\x003\x004\x0010x10\x00page=2": "old",
+    "/docs/a.pdfx\x001\x002\x0010x10":          "old",
+    "/docs/b.pdf\x001\x002\x0010x10":           "old",
+  }
+  got := map[string]string{}
+  db.View(func(tx *bolt.Tx) error {
+    return tx.Bucket(bucket_name).ForEach(func(k, v []byte) error {
+      got[string(k)] = string(v)
+      return nil
+    })
+  })
+  if len(got) != len(want) {
+    t.Fatalf("cache holds %q, want %q", got, want)
+  }
+  for k, v := range want {
+    if got[k] != v {
+      t.Errorf("cache holds %q, want %q", got, want)
+      break
+    }
+  }
+  if value := cache_get(db, newKey); string(value) != "new" {
+    t.Errorf("cache_get = %q, want new", value)
+  }
+  if value := cache_get(db, []byte("/docs/c.pdf")); value != nil {
+    t.Errorf("cache_get of a missing key = %q", value)
+  }
+}
+
+// seed_cache writes entries of size bytes last used at the given times, bypassing cache_put
+func seed_cache(t *testing.T, db *bolt.DB, size int, used map[string]time.Time) {
+  t.Helper()
+  err := db.Update(func(tx *bolt.Tx) error {
+    for key, at := range used {
+      if err := tx.Bucket(bucket_name).Put([]byte(key), make([]byte, size)); err != nil {
+        return err
+      }
+      if at.IsZero() {
+        continue
+      }
+      if err := tx.Bucket(meta_bucket_name).Put([]byte(key), encode_meta(at, at)); err != nil {
+        return err
+      }
+    }
+    return nil
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+}
+
+// cached_paths returns the paths of the entries left, least recently used first
+func cached_paths(t *testing.T) []string {
+  t.Helper()
+  entries, err := ListCache()
+  if err != nil {
+    t.Fatal(err)
+  }
+  paths := []string{}
+  for _, entry := range entries {
+    paths = append(paths, entry.Path)
+  }
+  return paths
+}
+
+func TestCachePutEvictsLeastRecentlyUsed(t *testing.T) {
+  with_cache(t)
+  db, err := open_db()
+  if err != nil {
+    t.Fatal(err)
+  }
+  now := time.Now()
+  seed_cache(t, db, 100, map[string]time.Time{
+    "/a\x00v": now.Add(-time.Hour),
+    "/b\x00v": now.Add(-3 * time.Hour),
+    "/c\x00v": now.Add(-2 * time.Hour),
+  })
+  // a hit makes b the most recently used
+  if cache_get(db, []byte("/b\x00v")) == nil {
+    t.Fatal("seeded entry missing")
+  }
+  // the new entry itself is never evicted, even when it alone is over max
+  if err := cache_put(db, []byte("/d\x00v"), make([]byte, 100), 250); err != nil {
+    t.Fatal(err)
+  }
+  db.Close()
+
+  if got, want := fmt.Sprint(cached_paths(t)), "[/b /d]"; got != want {
+    t.Errorf("cache holds %s, want %s", got, want)
+  }
+}
+
+func TestCacheEntryCommands(t *testing.T) {
+  with_cache(t)
+  db, err := open_db()
+  if err != nil {
+    t.Fatal(err)
+  }
+  now := time.Now()
+  abs, _ := filepath.Abs("doc.pdf")
+  seed_cache(t, db, 10, map[string]time.Time{
+    "/old\x00v":        now.Add(-48 * time.Hour),
+    "/recent\x00v":     now.Add(-time.Hour),
+    "/unknown\x00v":    {},
+    abs + "\x001\x002": now,
+    abs + "\x003\x004": now.Add(-time.Minute),
+  })
+  db.Close()
+
+  entries, err := ListCache()
+  if err != nil {
+    t.Fatal(err)
+  }
+  if got, want := fmt.Sprint(cached_paths(t)), "[/unknown /old /recent "+abs+" "+abs+"]"; got != want {
+    t.Fatalf("ListCache = %s, want %s", got, want)
+  }
+  if got := entries[len(entries)-1]; got.Params != "1 2" || got.Size != 10 {
+    t.Errorf("newest entry is %+v, want params \"1 2\" and size 10", got)
+  }
+
+  // entries with no recorded usage are pruned too
+  if removed, err := PruneCache(24 * time.Hour); err != nil || removed != 2 {
+    t.Errorf("PruneCache removed %d (%v), want 2", removed, err)
+  }
+  if removed, err := RemoveCached("doc.pdf"); err != nil || removed != 2 {
+    t.Errorf("RemoveCached removed %d (%v), want 2", removed, err)
+  }
+  if got, want := fmt.Sprint(cached_paths(t)), "[/recent]"; got != want {
+    t.Errorf("cache holds %s, want %s", got, want)
+  }
+  if removed, err := ClearCache(); err != nil || removed != 1 {
+    t.Errorf("ClearCache removed %d (%v), want 1", removed, err)
+  }
+}
+
+func TestTrimCache(t *testing.T) {
+  with_cache(t)
+  db, err := open_db()
+  if err != nil {
+    t.Fatal(err)
+  }
+  now := time.Now()
+  seed_cache(t, db, 100, map[string]time.Time{
+    "/a\x00v": now.Add(-time.Hour),
+    "/b\x00v": now.Add(-3 * time.Hour),
+    "/c\x00v": now.Add(-2 * time.Hour),
+  })
+  db.Close()
+
+  if removed, err := TrimCache(150); err != nil || removed != 2 {
+    t.Errorf("TrimCache removed %d (%v), want 2", removed, err)
+  }
+  if got, want := fmt.Sprint(cached_paths(t)), "[/a]"; got != want {
+    t.Errorf("cache holds %s, want %s", got, want)
+  }
+  if removed, err := TrimCache(1000); err != nil || removed != 0 {
+    t.Errorf("TrimCache under the limit removed %d (%v)", removed, err)
+  }
+}
+
+func TestLastUsed(t *testing.T) {
+  created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+  accessed := created.Add(time.Hour)
+  tests := []struct {
+    name  string
+    entry CacheEntry
+    want  time.Time
+  }{
+    {"accessed", CacheEntry{Created: created, Accessed: accessed}, accessed},
+    {"never accessed", CacheEntry{Created: created}, created},
+    {"older version", CacheEntry{}, time.Time{}},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      if got := tt.entry.LastUsed(); !got.Equal(tt.want) {
+        t.Errorf("got %v, want %v", got, tt.want)
+      }
+    })
+  }
+}
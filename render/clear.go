@@ -0,0 +1,77 @@
+package render
+
+import (
+  "bufio"
+  "fmt"
+  "io"
+  "strings"
+
+  "github.com/BourgeoisBear/rasterm"
+)
+
+// Clear removes images drawn before. opts.ImageID limits it to that kitty image, and
+// opts.PlacementID to one of its placements. opts.Place limits it to the images inside that
+// rectangle, otherwise every kitty image is deleted. sixel, iterm and text output can only be
+// painted over, so they need a place, the rest of the screen is left alone
+func Clear(w io.Writer, opts Options) error {
+  protocol, err := resolve_protocol(opts)
+  if err != nil {
+    return err
+  }
+  if opts.ImageID != 0 && protocol != Kitty {
+    return fmt.Errorf("only kitty images have ids, clear %s images with a place", protocol)
+  }
+  if opts.PlacementID != 0 && opts.ImageID == 0 {
+    return fmt.Errorf("a placement id needs the id of its image")
+  }
+  if protocol != Kitty && !opts.Place.set() {
+    return fmt.Errorf("%s images are painted over, clearing them needs a place", protocol)
+  }
+
+  writer := bufio.NewWriter(w)
+  if protocol == Kitty {
+    passthrough := opts.Passthrough.resolve()
+    var cmds strings.Builder
+    switch {
+    case opts.ImageID != 0 && opts.PlacementID != 0:
+      kitty_delete(&cmds, fmt.Sprintf("d=I,i=%d,p=%d", opts.ImageID, opts.PlacementID))
+    case opts.ImageID != 0:
+      kitty_delete(&cmds, fmt.Sprintf("d=I,i=%d", opts.ImageID))
+    case opts.Place.set():
+      // kitty has no rectangle to delete by, only single cells, so every cell of it is asked for.
+      // naming the image with an id takes one command instead
+      for y := opts.Place.Y; y < opts.Place.Y+opts.Place.Rows; y++ {
+        for x := opts.Place.X; x < opts.Place.X+opts.Place.Cols; x++ {
+          kitty_delete(&cmds, fmt.Sprintf("d=P,x=%d,y=%d", x+1, y+1))
+        }
+      }
+    default:
+      kitty_delete(&cmds, "d=A")
+    }
+    if err := passthrough.write(writer, []byte(cmds.String())); err != nil {
+      return err
+    }
+  }
+
+  if opts.Place.set() {
+    // also takes the unicode placeholders of kitty images
+    blank_place(writer, opts.Place)
+  }
+
+  return writer.Flush()
+}
+
+// writes a kitty delete command, keys pick what is deleted
+func kitty_delete(out io.Writer, keys string) {
+  fmt.Fprintf(out, "%sa=d,%s,q=2%s", rasterm.KITTY_IMG_HDR, keys, rasterm.KITTY_IMG_FTR)
+}
+
+// paints the rectangle with spaces, leaving the cursor where it was
+func blank_place(out *bufio.Writer, p Place) {
+  out.WriteString("\x1b7\x1b[0m")
+  blank := strings.Repeat(" ", p.Cols)
+  for y := p.Y; y < p.Y+p.Rows; y++ {
+    fmt.Fprintf(out, "\x1b[%d;%dH%s", y+1, p.X+1, blank)
+  }
+  out.WriteString("\x1b8")
+}
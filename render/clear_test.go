@@ -0,0 +1,104 @@
+package render
+
+import (
+  "bytes"
+  "context"
+  "testing"
+)
+
+func TestClear(t *testing.T) {
+  del := func(keys string) string {
+    return "\x1b_Ga=d," + keys + ",q=2\x1b\\"
+  }
+  tests := []struct {
+    name     string
+    protocol Protocol
+    id, pid  uint32
+    place    Place
+    want     string
+    wantErr  bool
+  }{
+    {"kitty image", Kitty, 5, 0, Place{}, del("d=I,i=5"), false},
+    {"kitty placement", Kitty, 5, 2, Place{}, del("d=I,i=5,p=2"), false},
+    {
+      "kitty place", Kitty, 0, 0, Place{Cols: 2, Rows: 1, X: 3, Y: 4},
+      del("d=P,x=4,y=5") + del("d=P,x=5,y=5") + "\x1b7\x1b[0m\x1b[5;4H  \x1b8", false,
+    },
+    {"kitty everything", Kitty, 0, 0, Place{}, del("d=A"), false},
+    {"sixel place", Sixel, 0, 0, Place{Cols: 3, Rows: 2}, "\x1b7\x1b[0m\x1b[1;1H   \x1b[2;1H   \x1b8", false},
+    // the id is enough to find the image, only the place is blanked
+    {"kitty image in a place", Kitty, 5, 0, Place{Cols: 2, Rows: 1}, del("d=I,i=5") + "\x1b7\x1b[0m\x1b[1;1H  \x1b8", false},
+    {"kitty placement without its image", Kitty, 0, 2, Place{}, "", true},
+    // nothing outside the place is painted over
+    {"sixel everything", Sixel, 0, 0, Place{}, "", true},
+    {"text everything", Blocks, 0, 0, Place{}, "", true},
+    {"sixel has no ids", Sixel, 5, 0, Place{Cols: 1, Rows: 1}, "", true},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      opts := test_options(tt.protocol)
+      opts.ImageID, opts.PlacementID = tt.id, tt.pid
+      opts.Place = tt.place
+      out := new(bytes.Buffer)
+      err := Clear(out, opts)
+      if tt.wantErr {
+        if err == nil {
+          t.Errorf("got %q, want an error", out.String())
+        }
+        return
+      }
+      if err != nil {
+        t.Fatal(err)
+      }
+      if out.String() != tt.want {
+        t.Errorf("got %q, want %q", out.String(), tt.want)
+      }
+    })
+  }
+}
+
+func TestClearPassthrough(t *testing.T) {
+  // only the kitty commands are passed through, the blanking is text
+  opts := test_options(Kitty)
+  opts.Passthrough = Screen
+  opts.Place = Place{Cols: 1, Rows: 1}
+  out := new(bytes.Buffer)
+  if err := Clear(out, opts); err != nil {
+    t.Fatal(err)
+  }
+  want := "\x1bP\x1b_Ga=d,d=P,x=1,y=1,q=2\x1b\x1b\\" + "\x1bP\\\x1b\\" + "\x1b7\x1b[0m\x1b[1;1H \x1b8"
+  if out.String() != want {
+    t.Errorf("got %q, want %q", out.String(), want)
+  }
+}
+
+func TestRenderImageID(t *testing.T) {
+  path := test_file(t, "img.png", test_png(t, 64, 48))
+  tests := []struct {
+    name        string
+    placeholder bool
+    id, pid     uint32
+    want        map[string]string
+  }{
+    {"image", false, 9, 0, map[string]string{"a": "T", "i": "9"}},
+    {"placement", false, 9, 2, map[string]string{"a": "T", "i": "9", "p": "2"}},
+    {"placeholder", true, 0x01abcdef, 0, map[string]string{"a": "T", "i": "28036591", "U": "1"}},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      opts := test_options(Kitty)
+      opts.ImageID, opts.PlacementID = tt.id, tt.pid
+      opts.Placeholder = tt.placeholder
+      out := new(bytes.Buffer)
+      if err := Render(context.Background(), out, path, opts); err != nil {
+        t.Fatal(err)
+      }
+      cmd := kitty_commands(out.String())[0]
+      for k, v := range tt.want {
+        if cmd[k] != v {
+          t.Errorf("command %v, want %s=%s", cmd, k, v)
+        }
+      }
+    })
+  }
+}
@@ -0,0 +1,199 @@
+package render
+
+import (
+  "context"
+  "fmt"
+  "os/exec"
+  "path/filepath"
+  "strconv"
+  "strings"
+)
+
+// Converter is a backend that turns a page of a document into a png
+type Converter struct {
+  Name string
+  // Exts are the document extensions the converter can handle
+  Exts []string
+  // Binaries are tried in order, the first one found on PATH is used
+  Binaries []string
+  // Args builds the arguments that convert page of path into outDir
+  Args func(path string, ext string, page int, outDir string) []string
+  // Output finds the png the converter wrote into outDir,
+  // when nil the first png in outDir is used
+  Output func(path string, page int, outDir string) (string, error)
+}
+
+var converters = map[string]Converter{}
+
+// the order converters are tried in when none is configured
+var converter_order = []string{}
+
+// RegisterConverter adds c to the registry, replacing any converter with the same name.
+// new converters are tried after the ones already registered
+func RegisterConverter(c Converter) {
+  if _, exists := converters[c.Name]; !exists {
+    converter_order = append(converter_order, c.Name)
+  }
+  converters[c.Name] = c
+}
+
+// ConverterNames returns the registered converters in their default order
+func ConverterNames() []string {
+  return append([]string(nil), converter_order...)
+}
+
+func init() {
+  // fastest first, libreoffice is the only one handling office documents
+  RegisterConverter(pdftoppm_converter)
+  RegisterConverter(mutool_converter)
+  RegisterConverter(libreoffice_converter)
+}
+
+// dpi used by the pdf rasterizers
+const pdfResolution = 150
+
+var pdftoppm_converter = Converter{
+  Name:     "pdftoppm",
+  Exts:     []string{".pdf"},
+  Binaries: []string{"pdftoppm"},
+  Args: func(path string, ext string, page int, outDir string) []string {
+    return []string{
+      "-png",
+      "-r", strconv.Itoa(pdfResolution),
+      "-f", strconv.Itoa(page),
+      "-l", strconv.Itoa(page),
+      "-singlefile",
+      path,
+      filepath.Join(outDir, "page"),
+    }
+  },
+  Output: func(path string, page int, outDir string) (string, error) {
+    return filepath.Join(outDir, "page.png"), nil
+  },
+}
+
+var mutool_converter = Converter{
+  Name:     "mutool",
+  Exts:     []string{".pdf"},
+  Binaries: []string{"mutool"},
+  Args: func(path string, ext string, page int, outDir string) []string {
+    return []string{
+      "draw",
+      "-q",
+      "-r", strconv.Itoa(pdfResolution),
+      "-o", filepath.Join(outDir, "page.png"),
+      path,
+      strconv.Itoa(page),
+    }
+  },
+  Output: func(path string, page int, outDir string) (string, error) {
+    return filepath.Join(outDir, "page.png"), nil
+  },
+}
+
+// the png export filter of the libreoffice module that opens each document type
+var libre_filters = map[string]string{
+  ".pdf":  "draw_png_Export",
+  ".odg":  "draw_png_Export",
+  ".xls":  "calc_png_Export",
+  ".ods":  "calc_png_Export",
+  ".xlsx": "calc_png_Export",
+  ".doc":  "writer_png_Export",
+  ".docx": "writer_png_Export",
+  ".odt":  "writer_png_Export",
+  ".ppt":  "impress_png_Export",
+  ".pptx": "impress_png_Export",
+  ".odp":  "impress_png_Export",
+}
+
+var libreoffice_converter = Converter{
+  Name:     "libreoffice",
+  Exts:     []string{".pdf", ".xls", ".xlsx", ".doc", ".docx", ".ppt", ".pptx", ".ods", ".odp", ".odg", ".odt"},
+  Binaries: []string{"libreoffice", "soffice"},
+  Args: func(path string, ext string, page int, outDir string) []string {
+    // plain png export only ever gives the first page
+    convertTo := "png"
+    if page > 1 {
+      convertTo = fmt.Sprintf(`png:%s:{"PageRange":{"type":"string","value":"%d"}}`, libre_filters[ext], page)
+    }
+    return []string{
+      "--headless",
+      "--convert-to",
+      convertTo,
+      path,
+      "--outdir",
+      outDir,
+    }
+  },
+  Output: func(path string, page int, outDir string) (string, error) {
+    tmpFile := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + ".png"
+    return filepath.Join(outDir, tmpFile), nil
+  },
+}
+
+// finds the binary of the converter on PATH
+func (c Converter) binary() (string, bool) {
+  for _, bin := range c.Binaries {
+    if command_exists(bin) {
+      return bin, true
+    }
+  }
+  return "", false
+}
+
+func (c Converter) handles(ext string) bool {
+  for _, e := range c.Exts {
+    if e == ext {
+      return true
+    }
+  }
+  return false
+}
+
+// is_document reports if any registered converter handles the format ext
+func is_document(ext string) bool {
+  for _, name := range converter_order {
+    if converters[name].handles(ext) {
+      return true
+    }
+  }
+  return false
+}
+
+// pick_converter returns the first converter in order that handles ext and is installed,
+// an empty order means the default order
+func pick_converter(ext string, order []string) (Converter, string, bool) {
+  if len(order) == 0 {
+    order = converter_order
+  }
+  for _, name := range order {
+    c, exists := converters[strings.ToLower(strings.TrimSpace(name))]
+    if !exists {
+      logger.Write(fmt.Sprintf("unknown converter: %s", name))
+      continue
+    }
+    if !c.handles(ext) {
+      continue
+    }
+    if bin, found := c.binary(); found {
+      return c, bin, true
+    }
+  }
+  return Converter{}, "", false
+}
+
+func (c Converter) command(ctx context.Context, bin string, path string, ext string, page int, outDir string) *exec.Cmd {
+  return exec.CommandContext(ctx, bin, c.Args(path, ext, page, outDir)...)
+}
+
+// output returns the png the converter produced
+func (c Converter) output(path string, page int, outDir string) (string, error) {
+  if c.Output != nil {
+    return c.Output(path, page, outDir)
+  }
+  matches, _ := filepath.Glob(filepath.Join(outDir, "*.png"))
+  if len(matches) == 0 {
+    return "", fmt.Errorf("%s produced no png", c.Name)
+  }
+  return matches[0], nil
+}
@@ -0,0 +1,138 @@
+package render
+
+import (
+  "os"
+  "path/filepath"
+  "runtime"
+  "testing"
+)
+
+// with_registry restores the converter registry once the test is done
+func with_registry(t *testing.T) {
+  t.Helper()
+  saved := map[string]Converter{}
+  for name, c := range converters {
+    saved[name] = c
+  }
+  order := ConverterNames()
+  t.Cleanup(func() {
+    converters, converter_order = saved, order
+  })
+}
+
+// stub_path makes PATH hold nothing but executables named bins, so installed converters aren't found
+func stub_path(t *testing.T, bins ...string) string {
+  t.Helper()
+  if runtime.GOOS == "windows" {
+    t.Skip("stub converters are shell scripts")
+  }
+  dir := t.TempDir()
+  for _, bin := range bins {
+    if err := os.WriteFile(filepath.Join(dir, bin), []byte("#!/bin/sh\n"), 0755); err != nil {
+      t.Fatal(err)
+    }
+  }
+  t.Setenv("PATH", dir)
+  return dir
+}
+
+func TestRegisterConverter(t *testing.T) {
+  with_registry(t)
+  builtin := ConverterNames()
+
+  RegisterConverter(Converter{Name: "first", Exts: []string{".xps"}})
+  RegisterConverter(Converter{Name: "second", Exts: []string{".xps"}})
+  // replaces first but keeps its place
+  RegisterConverter(Converter{Name: "first", Exts: []string{".djvu"}})
+
+  names := ConverterNames()
+  want := append(builtin, "first", "second")
+  if len(names) != len(want) {
+    t.Fatalf("names %v, want %v", names, want)
+  }
+  for i := range want {
+    if names[i] != want[i] {
+      t.Fatalf("names %v, want %v", names, want)
+    }
+  }
+  if !converters["first"].handles(".djvu") || converters["first"].handles(".xps") {
+    t.Errorf("first wasn't replaced: %v", converters["first"].Exts)
+  }
+  if !is_document(".djvu") || !is_document(".xps") {
+    t.Error("registered extensions aren't documents")
+  }
+
+  // the copy returned can't change the order
+  names[0] = "changed"
+  if ConverterNames()[0] == "changed" {
+    t.Error("ConverterNames returned the registry's own slice")
+  }
+}
+
+func TestPickConverter(t *testing.T) {
+  // pdftoppm and libreoffice aren't installed, libreoffice is reachable as soffice
+  stub_path(t, "mutool", "soffice")
+
+  tests := []struct {
+    name  string
+    ext   string
+    order []string
+    // the converter and binary picked, empty when none is
+    want    string
+    wantBin string
+  }{
+    {"built-in order skips missing", ".pdf", nil, "mutool", "mutool"},
+    {"second binary", ".docx", nil, "libreoffice", "soffice"},
+    {"config order first", ".pdf", []string{"libreoffice", "mutool"}, "libreoffice", "soffice"},
+    {"config names are normalized", ".pdf", []string{" MuTool "}, "mutool", "mutool"},
+    {"unknown names are skipped", ".pdf", []string{"nope", "mutool"}, "mutool", "mutool"},
+    {"config order isn't extended", ".pdf", []string{"pdftoppm"}, "", ""},
+    {"unhandled by config order", ".docx", []string{"mutool"}, "", ""},
+    {"not a document", ".png", nil, "", ""},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      c, bin, found := pick_converter(tt.ext, tt.order)
+      if found != (tt.want != "") || c.Name != tt.want || bin != tt.wantBin {
+        t.Errorf("got %q with %q (found %v), want %q with %q", c.Name, bin, found, tt.want, tt.wantBin)
+      }
+    })
+  }
+}
+
+func TestConverterOutput(t *testing.T) {
+  withPng := t.TempDir()
+  if err := os.WriteFile(filepath.Join(withPng, "out.png"), nil, 0644); err != nil {
+    t.Fatal(err)
+  }
+  empty := t.TempDir()
+
+  tests := []struct {
+    name      string
+    converter Converter
+    path      string
+    outDir    string
+    // empty when no png should be found
+    want string
+  }{
+    {"first png", Converter{Name: "stub"}, "/docs/report.pdf", withPng, filepath.Join(withPng, "out.png")},
+    {"no png", Converter{Name: "stub"}, "/docs/report.pdf", empty, ""},
+    {"pdftoppm", pdftoppm_converter, "/docs/report.pdf", empty, filepath.Join(empty, "page.png")},
+    {"mutool", mutool_converter, "/docs/report.pdf", empty, filepath.Join(empty, "page.png")},
+    {"libreoffice names it after the document", libreoffice_converter, "/docs/report.docx", empty, filepath.Join(empty, "report.png")},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      got, err := tt.converter.output(tt.path, 2, tt.outDir)
+      if tt.want == "" {
+        if err == nil {
+          t.Errorf("got %q, want an error", got)
+        }
+        return
+      }
+      if err != nil || got != tt.want {
+        t.Errorf("got %q (%v), want %q", got, err, tt.want)
+      }
+    })
+  }
+}
@@ -0,0 +1,295 @@
+package render
+
+import (
+  "fmt"
+  "image"
+  "image/color"
+  "math"
+  "math/rand"
+  "strings"
+  "sync"
+)
+
+type Dither string
+
+const (
+  NoDither       Dither = "none"
+  FloydSteinberg Dither = "floyd-steinberg"
+  Atkinson       Dither = "atkinson"
+  Bayer4         Dither = "bayer4"
+  Bayer8         Dither = "bayer8"
+  BlueNoise      Dither = "blue-noise"
+)
+
+// ParseDither maps a user supplied dithering algorithm to a Dither
+func ParseDither(dither string) (Dither, error) {
+  switch d := Dither(strings.ToLower(dither)); d {
+  case NoDither, FloydSteinberg, Atkinson, Bayer4, Bayer8, BlueNoise:
+    return d, nil
+  }
+  return "", fmt.Errorf("invalid dither '%s'. Must be none, floyd-steinberg, atkinson, bayer4, bayer8 or blue-noise", dither)
+}
+
+// a share of the error pushed to the pixel at dx, dy
+type diffusion struct {
+  dx, dy int
+  weight float64
+}
+
+var floyd_steinberg_kernel = []diffusion{
+  {1, 0, 7.0 / 16}, {-1, 1, 3.0 / 16}, {0, 1, 5.0 / 16}, {1, 1, 1.0 / 16},
+}
+
+// atkinson only spreads 3/4 of the error, which keeps flat areas and line art clean
+var atkinson_kernel = []diffusion{
+  {1, 0, 1.0 / 8}, {2, 0, 1.0 / 8}, {-1, 1, 1.0 / 8}, {0, 1, 1.0 / 8}, {1, 1, 1.0 / 8}, {0, 2, 1.0 / 8},
+}
+
+var bayer4_matrix = [][]float64{
+  {0, 8, 2, 10},
+  {12, 4, 14, 6},
+  {3, 11, 1, 9},
+  {15, 7, 13, 5},
+}
+
+var bayer8_matrix = func() [][]float64 {
+  m := make([][]float64, 8)
+  for y := range m {
+    m[y] = make([]float64, 8)
+    for x := range m[y] {
+      // each 4x4 quadrant interleaves the 2x2 pattern with the 4x4 one
+      m[y][x] = 4*bayer4_matrix[y%4][x%4] + []float64{0, 2, 3, 1}[(y/4)*2+x/4]
+    }
+  }
+  return m
+}()
+
+// nearest finds the closest palette entry, memoizing by 6 bits per channel
+type nearest struct {
+  palette color.Palette
+  rgb     [][3]float64
+  memo    []int16
+}
+
+func new_nearest(p color.Palette) *nearest {
+  n := &nearest{palette: p, memo: make([]int16, 1<<18)}
+  for i := range n.memo {
+    n.memo[i] = -1
+  }
+  for _, c := range p {
+    r, g, b, _ := c.RGBA()
+    n.rgb = append(n.rgb, [3]float64{float64(r >> 8), float64(g >> 8), float64(b >> 8)})
+  }
+  return n
+}
+
+func clamp8(v float64) float64 {
+  return math.Max(0, math.Min(255, v))
+}
+
+func (n *nearest) index(r, g, b float64) int {
+  r, g, b = clamp8(r), clamp8(g), clamp8(b)
+  key := int(r)>>2<<12 | int(g)>>2<<6 | int(b)>>2
+  if i := n.memo[key]; i >= 0 {
+    return int(i)
+  }
+  best, bestDist := 0, math.MaxFloat64
+  for i, c := range n.rgb {
+    dr, dg, db := r-c[0], g-c[1], b-c[2]
+    if dist := dr*dr + dg*dg + db*db; dist < bestDist {
+      best, bestDist = i, dist
+    }
+  }
+  n.memo[key] = int16(best)
+  return best
+}
+
+// quantize maps src onto the palette p with this dithering,
+// the zero value dithers with floyd-steinberg
+func (d Dither) quantize(src image.Image, p color.Palette) *image.Paletted {
+  bounds := src.Bounds()
+  dst := image.NewPaletted(bounds, p)
+  w, h := bounds.Dx(), bounds.Dy()
+  if w == 0 || h == 0 || len(p) == 0 {
+    return dst
+  }
+
+  pixels := make([][3]float64, w*h)
+  for y := 0; y < h; y++ {
+    for x := 0; x < w; x++ {
+      // not premultiplied, so the edges of transparent images keep their color
+      c := color.NRGBAModel.Convert(src.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+      pixels[y*w+x] = [3]float64{float64(c.R), float64(c.G), float64(c.B)}
+    }
+  }
+
+  n := new_nearest(p)
+  switch d {
+  case Bayer4, Bayer8, BlueNoise:
+    d.ordered(dst, pixels, n)
+  case NoDither:
+    for i, px := range pixels {
+      dst.Pix[(i/w)*dst.Stride+i%w] = uint8(n.index(px[0], px[1], px[2]))
+    }
+  default:
+    kernel := floyd_steinberg_kernel
+    if d == Atkinson {
+      kernel = atkinson_kernel
+    }
+    diffuse(dst, pixels, n, kernel)
+  }
+
+  return dst
+}
+
+// error diffusion, pushing what each pixel misses onto its unvisited neighbours
+func diffuse(dst *image.Paletted, pixels [][3]float64, n *nearest, kernel []diffusion) {
+  w, h := dst.Bounds().Dx(), dst.Bounds().Dy()
+  for y := 0; y < h; y++ {
+    for x := 0; x < w; x++ {
+      px := pixels[y*w+x]
+      i := n.index(px[0], px[1], px[2])
+      dst.Pix[y*dst.Stride+x] = uint8(i)
+
+      chosen := n.rgb[i]
+      for _, k := range kernel {
+        nx, ny := x+k.dx, y+k.dy
+        if nx < 0 || nx >= w || ny >= h {
+          continue
+        }
+        for ch := 0; ch < 3; ch++ {
+          pixels[ny*w+nx][ch] += (clamp8(px[ch]) - chosen[ch]) * k.weight
+        }
+      }
+    }
+  }
+}
+
+// ordered dithering, nudging every pixel by a fixed threshold map so the
+// same input always gives the same output, which keeps animations stable
+func (d Dither) ordered(dst *image.Paletted, pixels [][3]float64, n *nearest) {
+  var threshold func(x, y int) float64
+  switch d {
+  case Bayer4:
+    threshold = func(x, y int) float64 { return (bayer4_matrix[y%4][x%4] + 0.5) / 16 }
+  case Bayer8:
+    threshold = func(x, y int) float64 { return (bayer8_matrix[y%8][x%8] + 0.5) / 64 }
+  default:
+    noise := blue_noise()
+    threshold = func(x, y int) float64 { return noise[(y%blueNoiseSize)*blueNoiseSize+x%blueNoiseSize] }
+  }
+
+  // each pixel is nudged by the distance from its nearest color to the next one. the nudge moves
+  // all channels at once, so it is kept under half of that distance and a flat color stays itself
+  spread := make([]float64, len(n.rgb))
+  for i, c := range n.rgb {
+    spread[i] = 255
+    for j, o := range n.rgb {
+      if i != j {
+        dr, dg, db := c[0]-o[0], c[1]-o[1], c[2]-o[2]
+        spread[i] = math.Min(spread[i], math.Sqrt((dr*dr+dg*dg+db*db)/3))
+      }
+    }
+  }
+
+  w, h := dst.Bounds().Dx(), dst.Bounds().Dy()
+  for y := 0; y < h; y++ {
+    for x := 0; x < w; x++ {
+      px := pixels[y*w+x]
+      offset := (threshold(x, y) - 0.5) * spread[n.index(px[0], px[1], px[2])]
+      dst.Pix[y*dst.Stride+x] = uint8(n.index(px[0]+offset, px[1]+offset, px[2]+offset))
+    }
+  }
+}
+
+const blueNoiseSize = 64
+
+var blue_noise_once sync.Once
+var blue_noise_map []float64
+
+// blue_noise returns a blueNoiseSize^2 threshold map in 0..1 made with void and cluster,
+// seeded so every run gets the same map
+func blue_noise() []float64 {
+  blue_noise_once.Do(func() {
+    const size = blueNoiseSize
+    const cells = size * size
+    const sigma = 1.5
+
+    // gaussian falloff by toroidal distance
+    falloff := make([]float64, cells)
+    for y := 0; y < size; y++ {
+      for x := 0; x < size; x++ {
+        dx, dy := min(x, size-x), min(y, size-y)
+        falloff[y*size+x] = math.Exp(-float64(dx*dx+dy*dy) / (2 * sigma * sigma))
+      }
+    }
+
+    pattern := make([]bool, cells)
+    energy := make([]float64, cells)
+    toggle := func(i int, on bool) {
+      pattern[i] = on
+      sign := 1.0
+      if !on {
+        sign = -1
+      }
+      ix, iy := i%size, i/size
+      for y := 0; y < size; y++ {
+        for x := 0; x < size; x++ {
+          dx, dy := (x-ix+size)%size, (y-iy+size)%size
+          energy[y*size+x] += sign * falloff[dy*size+dx]
+        }
+      }
+    }
+    // tightest cluster is the set cell with the most energy, largest void the empty one with the least
+    extreme := func(set bool) int {
+      best := -1
+      for i := range pattern {
+        if pattern[i] != set {
+          continue
+        }
+        if best < 0 || (set && energy[i] > energy[best]) || (!set && energy[i] < energy[best]) {
+          best = i
+        }
+      }
+      return best
+    }
+
+    rng := rand.New(rand.NewSource(1))
+    initial := cells / 10
+    for _, i := range rng.Perm(cells)[:initial] {
+      toggle(i, true)
+    }
+    // spread the initial points until moving the tightest one doesn't help
+    for {
+      cluster := extreme(true)
+      toggle(cluster, false)
+      void := extreme(false)
+      if void == cluster {
+        toggle(cluster, true)
+        break
+      }
+      toggle(void, true)
+    }
+
+    ranks := make([]int, cells)
+    saved := append([]bool(nil), pattern...)
+    savedEnergy := append([]float64(nil), energy...)
+    for rank := initial - 1; rank >= 0; rank-- {
+      cluster := extreme(true)
+      toggle(cluster, false)
+      ranks[cluster] = rank
+    }
+    pattern, energy = saved, savedEnergy
+    for rank := initial; rank < cells; rank++ {
+      void := extreme(false)
+      toggle(void, true)
+      ranks[void] = rank
+    }
+
+    blue_noise_map = make([]float64, cells)
+    for i, rank := range ranks {
+      blue_noise_map[i] = (float64(rank) + 0.5) / cells
+    }
+  })
+  return blue_noise_map
+}
@@ -0,0 +1,200 @@
+package render
+
+import (
+  "bytes"
+  "fmt"
+  "image"
+  "image/color"
+  "sort"
+  "testing"
+)
+
+var all_dithers = []Dither{NoDither, FloydSteinberg, Atkinson, Bayer4, Bayer8, BlueNoise}
+
+var black_white = color.Palette{color.Black, color.White}
+
+// flat_image is a w x h image of a single color
+func flat_image(w, h int, c color.Color) image.Image {
+  return rows_image(w, func() []color.Color {
+    rows := make([]color.Color, h)
+    for i := range rows {
+      rows[i] = c
+    }
+    return rows
+  }()...)
+}
+
+// lit returns the share of pixels mapped to the last palette entry
+func lit(p *image.Paletted) float64 {
+  n := 0
+  for _, i := range p.Pix {
+    if int(i) == len(p.Palette)-1 {
+      n++
+    }
+  }
+  return float64(n) / float64(len(p.Pix))
+}
+
+func TestParseDither(t *testing.T) {
+  tests := []struct {
+    input   string
+    want    Dither
+    wantErr bool
+  }{
+    {"none", NoDither, false},
+    {"floyd-steinberg", FloydSteinberg, false},
+    {"Atkinson", Atkinson, false},
+    {"bayer4", Bayer4, false},
+    {"BAYER8", Bayer8, false},
+    {"blue-noise", BlueNoise, false},
+    {"bayer2", "", true},
+    {"floyd", "", true},
+    {"", "", true},
+  }
+  for _, tt := range tests {
+    t.Run(tt.input, func(t *testing.T) {
+      got, err := ParseDither(tt.input)
+      if tt.wantErr {
+        if err == nil {
+          t.Errorf("ParseDither(%q) = %q, want an error", tt.input, got)
+        }
+        return
+      }
+      if err != nil || got != tt.want {
+        t.Errorf("ParseDither(%q) = %q, %v, want %q", tt.input, got, err, tt.want)
+      }
+    })
+  }
+}
+
+func TestQuantizeIsDeterministic(t *testing.T) {
+  img := test_image(64, 48)
+  for _, d := range all_dithers {
+    t.Run(string(d), func(t *testing.T) {
+      first := d.quantize(img, xterm256)
+      for i := 0; i < 3; i++ {
+        if again := d.quantize(img, xterm256); !bytes.Equal(first.Pix, again.Pix) {
+          t.Fatal("the same image dithered differently")
+        }
+      }
+    })
+  }
+}
+
+func TestQuantizeKeepsFlatColors(t *testing.T) {
+  tests := []struct {
+    name    string
+    c       color.Color
+    palette color.Palette
+  }{
+    {"black", color.Black, black_white},
+    {"white", color.White, black_white},
+    {"fitted palette", color.RGBA{0x12, 0x34, 0x56, 0xff}, median_cut(flat_image(4, 4, color.RGBA{0x12, 0x34, 0x56, 0xff}), 16)},
+    // colors of the terminal palettes, whose neighbours are closer than the cube steps
+    {"xterm cube", color.RGBA{0x87, 0xaf, 0x5f, 0xff}, xterm256},
+    {"xterm gray ramp", color.RGBA{0x80, 0x80, 0x80, 0xff}, xterm256},
+    {"ansi magenta", color.RGBA{0xcd, 0x00, 0xcd, 0xff}, ansi16},
+  }
+  for _, tt := range tests {
+    for _, d := range all_dithers {
+      t.Run(tt.name+"/"+string(d), func(t *testing.T) {
+        want := uint8(tt.palette.Index(tt.c))
+        got := d.quantize(flat_image(16, 16, tt.c), tt.palette)
+        for i, idx := range got.Pix {
+          if idx != want {
+            t.Fatalf("pixel %d is %v, want %v everywhere", i, tt.palette[idx], tt.palette[want])
+          }
+        }
+      })
+    }
+  }
+}
+
+func TestQuantizeKeepsLevels(t *testing.T) {
+  // dithering a gray onto black and white lights about as many pixels as the gray is bright
+  levels := []uint8{0x20, 0x60, 0x80, 0xc0}
+  for _, d := range all_dithers[1:] {
+    levels := levels
+    if d == Atkinson {
+      // atkinson drops a quarter of the error, it only holds in the mid tones
+      levels = []uint8{0x80}
+    }
+    for _, level := range levels {
+      t.Run(fmt.Sprintf("%s/%#x", d, level), func(t *testing.T) {
+        got := lit(d.quantize(flat_image(64, 64, color.Gray{level}), black_white))
+        if want := float64(level) / 0xff; got < want-0.06 || got > want+0.06 {
+          t.Errorf("%.2f lit for a %.2f gray", got, want)
+        }
+      })
+    }
+  }
+
+  // without dithering the gray is only thresholded
+  if got := lit(NoDither.quantize(flat_image(8, 8, color.Gray{0x60}), black_white)); got != 0 {
+    t.Errorf("none lit %.2f of a dark gray", got)
+  }
+}
+
+func TestDiffusionStaysLocal(t *testing.T) {
+  // the error of colors the palette can't show mustn't pile up and leak into the areas it can
+  img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+  for y := 0; y < 32; y++ {
+    for x := 0; x < 32; x++ {
+      c := color.RGBA{0xff, 0xff, 0xff, 0xff}
+      if x < 16 {
+        // brighter than anything in the palette, its error is clamped away
+        c = color.RGBA{0xff, 0x00, 0x00, 0xff}
+      }
+      img.Set(x, y, c)
+    }
+  }
+  palette := color.Palette{color.Black, color.White, color.RGBA{0xc0, 0x00, 0x00, 0xff}}
+  for _, d := range []Dither{FloydSteinberg, Atkinson} {
+    t.Run(string(d), func(t *testing.T) {
+      got := d.quantize(img, palette)
+      for y := 0; y < 32; y++ {
+        for x := 18; x < 32; x++ {
+          if got.ColorIndexAt(x, y) != 1 {
+            t.Fatalf("error leaked into the white half at %d,%d", x, y)
+          }
+        }
+      }
+    })
+  }
+}
+
+func TestThresholdMaps(t *testing.T) {
+  ranks := func(values []float64) []float64 {
+    sorted := append([]float64(nil), values...)
+    sort.Float64s(sorted)
+    return sorted
+  }
+  flatten := func(m [][]float64) []float64 {
+    var values []float64
+    for _, row := range m {
+      values = append(values, row...)
+    }
+    return values
+  }
+
+  // every level of a bayer matrix is used exactly once
+  for name, m := range map[string][][]float64{"bayer4": bayer4_matrix, "bayer8": bayer8_matrix} {
+    for i, v := range ranks(flatten(m)) {
+      if v != float64(i) {
+        t.Errorf("%s holds %v where level %d should be", name, v, i)
+        break
+      }
+    }
+  }
+
+  // blue noise thresholds are spread evenly over 0..1
+  noise := ranks(blue_noise())
+  if len(noise) != blueNoiseSize*blueNoiseSize {
+    t.Fatalf("blue noise has %d thresholds", len(noise))
+  }
+  for i, v := range noise {
+    if want := (float64(i) + 0.5) / float64(len(noise)); v != want {
+      t.Fatalf("threshold %d is %v, want %v", i, v, want)
+    }
+  }
+}
@@ -0,0 +1,128 @@
+package render
+
+import (
+  "bytes"
+  "encoding/binary"
+  "image"
+  "io"
+  "os"
+)
+
+// the exif tag holding how the camera was held
+const exifOrientationTag = 0x0112
+
+// exif_orientation returns the exif orientation of a jpeg or tiff input, 1 (upright) when it has none
+func (in input) exif_orientation() int {
+  var r io.ReaderAt
+  var size int64
+  if in.data != nil {
+    r, size = bytes.NewReader(in.data), int64(len(in.data))
+  } else {
+    file, err := os.Open(in.path)
+    if err != nil {
+      return 1
+    }
+    defer file.Close()
+    info, err := file.Stat()
+    if err != nil {
+      return 1
+    }
+    r, size = file, info.Size()
+  }
+
+  switch in.format {
+  case ".jpg":
+    if exif := jpeg_exif(r, size); exif != nil {
+      return tiff_orientation(exif)
+    }
+  case ".tif":
+    return tiff_orientation(io.NewSectionReader(r, 0, size))
+  }
+  return 1
+}
+
+// jpeg_exif finds the tiff structure in the APP1 segment of a jpeg, nil when there is none
+func jpeg_exif(r io.ReaderAt, size int64) *io.SectionReader {
+  // segments after the start of image marker, the exif one comes before the image data
+  offset := int64(2)
+  header := make([]byte, 10)
+  for offset+4 <= size {
+    if _, err := r.ReadAt(header[:4], offset); err != nil || header[0] != 0xff {
+      return nil
+    }
+    marker := header[1]
+    if marker == 0xda || marker == 0xd9 {
+      return nil
+    }
+    length := int64(binary.BigEndian.Uint16(header[2:4]))
+    if marker == 0xe1 && length >= 8 {
+      if _, err := r.ReadAt(header, offset+4); err == nil && string(header[:6]) == "Exif\x00\x00" {
+        return io.NewSectionReader(r, offset+10, length-8)
+      }
+    }
+    offset += 2 + length
+  }
+  return nil
+}
+
+// tiff_orientation reads the orientation tag from the first ifd of a tiff structure, 1 when it has none
+func tiff_orientation(r *io.SectionReader) int {
+  header := make([]byte, 8)
+  if _, err := r.ReadAt(header, 0); err != nil {
+    return 1
+  }
+  var order binary.ByteOrder
+  switch string(header[:2]) {
+  case "II":
+    order = binary.LittleEndian
+  case "MM":
+    order = binary.BigEndian
+  default:
+    return 1
+  }
+  ifd := int64(order.Uint32(header[4:8]))
+
+  count := make([]byte, 2)
+  if _, err := r.ReadAt(count, ifd); err != nil {
+    return 1
+  }
+  entry := make([]byte, 12)
+  for i := int64(0); i < int64(order.Uint16(count)); i++ {
+    if _, err := r.ReadAt(entry, ifd+2+i*12); err != nil {
+      return 1
+    }
+    if order.Uint16(entry[0:2]) != exifOrientationTag {
+      continue
+    }
+    // a single short, stored in the value field itself
+    orientation := int(order.Uint16(entry[8:10]))
+    if orientation < 1 || orientation > 8 {
+      return 1
+    }
+    return orientation
+  }
+  return 1
+}
+
+// orient applies an exif orientation, turning img upright
+func orient(img image.Image, orientation int) image.Image {
+  switch orientation {
+  case 2:
+    return flip(img, true)
+  case 3:
+    return rotate(img, 2)
+  case 4:
+    return flip(img, false)
+  case 5:
+    // transposed, mirrored along the top left to bottom right diagonal
+    return flip(rotate(img, 1), true)
+  case 6:
+    return rotate(img, 1)
+  case 7:
+    // transversed, mirrored along the top right to bottom left diagonal
+    return flip(rotate(img, 1), false)
+  case 8:
+    return rotate(img, 3)
+  }
+  return img
+}
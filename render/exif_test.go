@@ -0,0 +1,139 @@
+package render
+
+import (
+  "bytes"
+  "context"
+  "encoding/binary"
+  "image"
+  "image/color"
+  "image/jpeg"
+  "testing"
+)
+
+// exif_tiff is a tiff structure whose only ifd entry is the orientation
+func exif_tiff(order binary.ByteOrder, orientation uint16) []byte {
+  data := make([]byte, 8+2+12+4)
+  if order == binary.LittleEndian {
+    copy(data, "II")
+  } else {
+    copy(data, "MM")
+  }
+  order.PutUint16(data[2:], 42)
+  order.PutUint32(data[4:], 8)
+  order.PutUint16(data[8:], 1)
+  entry := data[10:]
+  order.PutUint16(entry[0:], exifOrientationTag)
+  // a single short
+  order.PutUint16(entry[2:], 3)
+  order.PutUint32(entry[4:], 1)
+  order.PutUint16(entry[8:], orientation)
+  return data
+}
+
+// exif_jpeg is the start of a jpeg carrying tiff in its APP1 segment, after an APP0 one like most cameras write
+func exif_jpeg(tiff []byte) []byte {
+  data := []byte{0xff, 0xd8}
+  data = append(data, 0xff, 0xe0, 0x00, 0x10)
+  data = append(data, "JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00"...)
+  data = append(data, 0xff, 0xe1)
+  data = binary.BigEndian.AppendUint16(data, uint16(2+6+len(tiff)))
+  data = append(data, "Exif\x00\x00"...)
+  data = append(data, tiff...)
+  return append(data, 0xff, 0xda, 0x00, 0x02)
+}
+
+func TestExifOrientation(t *testing.T) {
+  tests := []struct {
+    name string
+    data []byte
+    want int
+  }{
+    {"jpeg little endian", exif_jpeg(exif_tiff(binary.LittleEndian, 6)), 6},
+    {"jpeg big endian", exif_jpeg(exif_tiff(binary.BigEndian, 8)), 8},
+    {"tiff", exif_tiff(binary.LittleEndian, 3), 3},
+    {"out of range", exif_jpeg(exif_tiff(binary.BigEndian, 9)), 1},
+    {"no exif", []byte{0xff, 0xd8, 0xff, 0xda, 0x00, 0x02}, 1},
+    {"truncated", exif_jpeg(exif_tiff(binary.LittleEndian, 6))[:30], 1},
+    {"png", test_png(t, 4, 4), 1},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      if got := data_input(tt.data).exif_orientation(); got != tt.want {
+        t.Errorf("got orientation %d, want %d", got, tt.want)
+      }
+    })
+  }
+}
+
+func TestOrient(t *testing.T) {
+  // 3x2 with the stored top left pixel marked
+  marked := color.RGBA{0xff, 0, 0, 0xff}
+  img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+  img.Set(0, 0, marked)
+
+  tests := []struct {
+    orientation int
+    // where the stored top left ends up once upright
+    x, y int
+  }{
+    {1, 0, 0},
+    {2, 2, 0},
+    {3, 2, 1},
+    {4, 0, 1},
+    {5, 0, 0},
+    {6, 1, 0},
+    {7, 1, 2},
+    {8, 0, 2},
+  }
+  for _, tt := range tests {
+    upright := orient(img, tt.orientation)
+    w, h := 3, 2
+    if tt.orientation >= 5 {
+      w, h = 2, 3
+    }
+    if upright.Bounds().Dx() != w || upright.Bounds().Dy() != h {
+      t.Errorf("orientation %d is %v, want %dx%d", tt.orientation, upright.Bounds().Size(), w, h)
+      continue
+    }
+    origin := upright.Bounds().Min
+    if upright.At(origin.X+tt.x, origin.Y+tt.y) != color.Color(marked) {
+      t.Errorf("orientation %d moved the top left away from %d,%d", tt.orientation, tt.x, tt.y)
+    }
+  }
+}
+
+func TestRenderAutoRotate(t *testing.T) {
+  // a landscape photo the camera took turned, orientation 6 stands it upright
+  buf := new(bytes.Buffer)
+  if err := jpeg.Encode(buf, test_image(80, 40), nil); err != nil {
+    t.Fatal(err)
+  }
+  app1 := exif_jpeg(exif_tiff(binary.BigEndian, 6))
+  // the APP0 and APP1 segments, before the stored image's own segments
+  segments := app1[2:bytes.Index(app1, []byte{0xff, 0xda})]
+  photo := append(append([]byte{0xff, 0xd8}, segments...), buf.Bytes()[2:]...)
+  path := test_file(t, "photo.jpg", photo)
+
+  tests := []struct {
+    name       string
+    autorotate bool
+    w, h       int
+  }{
+    {"upright", true, 40, 80},
+    {"as stored", false, 80, 40},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      opts := test_options(Sixel)
+      opts.AutoRotate = tt.autorotate
+      var got Report
+      opts.Report = func(r Report) { got = r }
+      if err := Render(context.Background(), new(bytes.Buffer), path, opts); err != nil {
+        t.Fatal(err)
+      }
+      if got.Width != tt.w || got.Height != tt.h {
+        t.Errorf("drew %dx%d, want %dx%d", got.Width, got.Height, tt.w, tt.h)
+      }
+    })
+  }
+}
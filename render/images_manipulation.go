@@ -0,0 +1,224 @@
+package render
+
+import (
+  "bytes"
+  "fmt"
+  "image"
+  "image/draw"
+  "image/png"
+  "strings"
+
+  "github.com/nfnt/resize"
+)
+
+type ResizeMethod string
+
+const (
+  Stretch ResizeMethod = "Stretch"
+  Crop    ResizeMethod = "Crop"
+  Fit     ResizeMethod = "Fit"
+)
+
+// cropImage crops the image to the specified width and height
+func cropImage(img image.Image, width, height int) image.Image {
+  srcBounds := img.Bounds()
+  srcWidth := srcBounds.Dx()
+  srcHeight := srcBounds.Dy()
+
+  // Calculate cropping dimensions
+  var cropWidth, cropHeight int
+  if float64(srcWidth)/float64(width) > float64(srcHeight)/float64(height) {
+    cropWidth = int(float64(srcHeight) * float64(width) / float64(height))
+    cropHeight = srcHeight
+  } else {
+    cropWidth = srcWidth
+    cropHeight = int(float64(srcWidth) * float64(height) / float64(width))
+  }
+
+  // Calculate cropping offsets
+  offsetX := (srcWidth - cropWidth) / 2
+  offsetY := (srcHeight - cropHeight) / 2
+
+  // Crop the image
+  cropped := img.(interface {
+    SubImage(r image.Rectangle) image.Image
+  }).SubImage(image.Rect(offsetX, offsetY, offsetX+cropWidth, offsetY+cropHeight))
+
+  // Resize the cropped image to the target dimensions
+  return resize.Resize(uint(width), uint(height), cropped, resize.Lanczos3)
+}
+
+func ResizeImage(img image.Image, width, height uint, method ResizeMethod) (image.Image, error) {
+  if img == nil {
+    return nil, fmt.Errorf("error decoding image")
+  }
+  bounds := img.Bounds()
+  srcWidth := bounds.Dx()
+  srcHeight := bounds.Dy()
+  width, height = computeDimensions(srcWidth, srcHeight, width, height)
+  switch method {
+  // unset fits, like the default options
+  case Fit, "":
+    return resize.Thumbnail(width, height, img, resize.Lanczos3), nil
+  case Stretch:
+    // Resize without preserving the aspect ratio
+    return resize.Resize(width, height, img, resize.Lanczos3), nil
+  case Crop:
+    // Crop the image to the specified dimensions
+    cropped := cropImage(img, int(width), int(height))
+    return cropped, nil
+  default:
+    return nil, fmt.Errorf("unsupported resize method: %s", method)
+  }
+}
+
+// to_rgba copies img into an RGBA starting at 0, 0, jpegs convert much faster this way than pixel by pixel
+func to_rgba(img image.Image) *image.RGBA {
+  bounds := img.Bounds()
+  dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+  draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+  return dst
+}
+
+// remap builds a w x h image, taking each pixel from the pixel of img that from returns for it
+func remap(img image.Image, w, h int, from func(x, y int) (int, int)) image.Image {
+  src := to_rgba(img)
+  dst := image.NewRGBA(image.Rect(0, 0, w, h))
+  for y := 0; y < h; y++ {
+    for x := 0; x < w; x++ {
+      sx, sy := from(x, y)
+      copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+    }
+  }
+  return dst
+}
+
+// rotate turns img clockwise by quarters of a turn
+func rotate(img image.Image, quarters int) image.Image {
+  w, h := img.Bounds().Dx(), img.Bounds().Dy()
+  switch (quarters%4 + 4) % 4 {
+  case 1:
+    return remap(img, h, w, func(x, y int) (int, int) { return y, h - 1 - x })
+  case 2:
+    return remap(img, w, h, func(x, y int) (int, int) { return w - 1 - x, h - 1 - y })
+  case 3:
+    return remap(img, h, w, func(x, y int) (int, int) { return w - 1 - y, x })
+  }
+  return img
+}
+
+// flip mirrors img left to right when horizontal, otherwise top to bottom
+func flip(img image.Image, horizontal bool) image.Image {
+  w, h := img.Bounds().Dx(), img.Bounds().Dy()
+  if horizontal {
+    return remap(img, w, h, func(x, y int) (int, int) { return w - 1 - x, y })
+  }
+  return remap(img, w, h, func(x, y int) (int, int) { return x, h - 1 - y })
+}
+
+func imageToBytes(img image.Image) []byte {
+  buf := bytes.Buffer{}
+  png.Encode(&buf, img)
+
+  return buf.Bytes()
+}
+func bytesToImage(bufBytes []byte) image.Image {
+  buf := bytes.NewBuffer(bufBytes)
+  img, _ := png.Decode(buf)
+  return img
+}
+
+// Align is where the image is drawn on the screen, <vertical>-<horizontal> with either half optional.
+// vertical is top, center or bottom and horizontal is left, center or right,
+// a missing half is centered, so "top" is top-center and "left" is center-left
+type Align string
+
+// AlignInline draws the image at the cursor, centered horizontally when Options.Center is set
+const AlignInline Align = ""
+
+// ParseAlign maps a user supplied alignment to an Align
+func ParseAlign(align string) (Align, error) {
+  a := Align(strings.ToLower(align))
+  if a == AlignInline {
+    return a, nil
+  }
+  vertical, horizontal := a.parts()
+  if vertical == "" || horizontal == "" {
+    return "", fmt.Errorf("invalid align '%s'. Must be top, center or bottom and / or left, center or right, like top-left", align)
+  }
+  return a, nil
+}
+
+// parts splits the alignment into its vertical and horizontal half, "" for a half that is invalid
+func (a Align) parts() (vertical, horizontal string) {
+  vertical, horizontal = "center", "center"
+  halves := strings.Split(string(a), "-")
+  if len(halves) > 2 {
+    return "", ""
+  }
+  if len(halves) == 2 {
+    vertical, horizontal = halves[0], halves[1]
+  } else {
+    switch halves[0] {
+    case "top", "bottom":
+      vertical = halves[0]
+    default:
+      horizontal = halves[0]
+    }
+  }
+
+  switch vertical {
+  case "top", "center", "bottom":
+  default:
+    vertical = ""
+  }
+  switch horizontal {
+  case "left", "center", "right":
+  default:
+    horizontal = ""
+  }
+  return
+}
+
+// AlignImage returns the offset in cells from the top left of the screen that puts img at align
+func AlignImage(img image.Image, sSize ScreenSize, align Align) (offsetX, offsetY int) {
+  bounds := img.Bounds()
+  cellW := max(sSize.widthPx/max(sSize.widthCell, 1), 1)
+  cellH := max(sSize.heightPx/max(sSize.heightCell, 1), 1)
+  vertical, horizontal := align.parts()
+
+  switch horizontal {
+  case "center":
+    offsetX = (sSize.widthPx - bounds.Dx()) / 2 / cellW
+  case "right":
+    offsetX = (sSize.widthPx - bounds.Dx()) / cellW
+  }
+  switch vertical {
+  case "center":
+    offsetY = (sSize.heightPx - bounds.Dy()) / 2 / cellH
+  case "bottom":
+    offsetY = sSize.heightCell - (bounds.Dy()+cellH-1)/cellH
+  }
+
+  return max(offsetX, 0), max(offsetY, 0)
+}
+
+func CenterImage(img image.Image, sSize ScreenSize) (offsetX, offsetY int) {
+  bounds := img.Bounds()
+  imgW := bounds.Dx()
+  imgH := bounds.Dy()
+  // in px
+  offsetX = (sSize.widthPx - imgW) / 2
+  offsetY = (sSize.heightPx - imgH) / 2
+  // in cells
+  offsetX = offsetX / (sSize.widthPx / sSize.widthCell)
+  offsetY = offsetY / (sSize.heightPx / sSize.heightCell)
+
+  if offsetY < 0 {
+    offsetY = 0
+  }
+  if offsetX < 0 {
+    offsetX = 0
+  }
+  return
+}
@@ -0,0 +1,128 @@
+package render
+
+import (
+  "bytes"
+  "context"
+  "fmt"
+  "strings"
+  "testing"
+)
+
+func TestParseAlign(t *testing.T) {
+  tests := []struct {
+    input   string
+    want    Align
+    wantErr bool
+  }{
+    {"", AlignInline, false},
+    {"center", "center", false},
+    {"top", "top", false},
+    {"left", "left", false},
+    {"Bottom-Right", "bottom-right", false},
+    {"top-center", "top-center", false},
+    {"center-left", "center-left", false},
+    {"left-top", "", true},
+    {"top-left-bottom", "", true},
+    {"middle", "", true},
+    {"top-", "", true},
+  }
+  for _, tt := range tests {
+    t.Run(tt.input, func(t *testing.T) {
+      got, err := ParseAlign(tt.input)
+      if tt.wantErr {
+        if err == nil {
+          t.Errorf("ParseAlign(%q) = %q, want an error", tt.input, got)
+        }
+        return
+      }
+      if err != nil || got != tt.want {
+        t.Errorf("ParseAlign(%q) = %q, %v, want %q", tt.input, got, err, tt.want)
+      }
+    })
+  }
+}
+
+func TestAlignImage(t *testing.T) {
+  // 10 x 15 px cells
+  sSize := ScreenSize{widthPx: 400, heightPx: 300, widthCell: 40, heightCell: 20}
+  tests := []struct {
+    align Align
+    w, h  int
+    x, y  int
+  }{
+    {"top-left", 100, 60, 0, 0},
+    {"top", 100, 60, 15, 0},
+    {"top-right", 100, 60, 30, 0},
+    {"left", 100, 60, 0, 8},
+    {"center", 100, 60, 15, 8},
+    {"right", 100, 60, 30, 8},
+    {"bottom-left", 100, 60, 0, 16},
+    {"bottom", 100, 60, 15, 16},
+    {"bottom-right", 100, 60, 30, 16},
+    // a partly filled row is a whole row
+    {"bottom-right", 95, 61, 30, 15},
+    // bigger than the screen is pinned to the top left
+    {"center", 500, 400, 0, 0},
+    {"bottom-right", 500, 400, 0, 0},
+    {"bottom-right", 400, 300, 0, 0},
+  }
+  for _, tt := range tests {
+    t.Run(fmt.Sprintf("%s/%dx%d", tt.align, tt.w, tt.h), func(t *testing.T) {
+      x, y := AlignImage(test_image(tt.w, tt.h), sSize, tt.align)
+      if x != tt.x || y != tt.y {
+        t.Errorf("offset %d,%d, want %d,%d", x, y, tt.x, tt.y)
+      }
+    })
+  }
+}
+
+func TestRenderAligned(t *testing.T) {
+  path := test_file(t, "img.png", test_png(t, 100, 60))
+  tests := []struct {
+    name     string
+    protocol Protocol
+    align    Align
+    // how the output starts, moving to the row and then the column
+    want string
+  }{
+    {"top left", Kitty, "top-left", "\r\x1b[1d\x1b_G"},
+    // the last row is left for the newline after the image
+    {"bottom right", Kitty, "bottom-right", "\r\x1b[16d\x1b[30C\x1b_G"},
+    {"center", Sixel, "center", "\r\x1b[9d\x1b[15C\x1bP"},
+    // text moves every line itself
+    {"text", Blocks, "right", "\r\x1b[9d\x1b[30C"},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      opts := test_options(tt.protocol)
+      opts.Align = tt.align
+      out := new(bytes.Buffer)
+      if err := Render(context.Background(), out, path, opts); err != nil {
+        t.Fatal(err)
+      }
+      if !strings.HasPrefix(out.String(), tt.want) {
+        t.Errorf("output starts %q, want %q", out.String()[:min(out.Len(), 40)], tt.want)
+      }
+      if tt.protocol.isText() {
+        if got := strings.Count(out.String(), "\n\x1b[30C"); got != 3 {
+          t.Errorf("%d of 3 following lines were moved", got)
+        }
+      }
+    })
+  }
+}
+
+func TestRenderAlignedClamps(t *testing.T) {
+  // a row short of the screen, bottom alignment would leave no room for the newline after it
+  path := test_file(t, "tall.png", test_png(t, 40, 570))
+  opts := test_options(Kitty)
+  opts.Width, opts.Height = NewDimension(4, Cell), NewDimension(19, Cell)
+  opts.Align = "bottom"
+  out := new(bytes.Buffer)
+  if err := Render(context.Background(), out, path, opts); err != nil {
+    t.Fatal(err)
+  }
+  if !strings.HasPrefix(out.String(), "\r\x1b[1d") {
+    t.Errorf("output starts %q, want it at the first row", out.String()[:min(out.Len(), 40)])
+  }
+}
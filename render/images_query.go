@@ -0,0 +1,270 @@
+package render
+
+import (
+  "bytes"
+  "context"
+  "fmt"
+  "image"
+  "image/gif"
+  "io"
+  "math"
+  "os"
+  "os/exec"
+  "strings"
+
+  "github.com/boltdb/bolt"
+  "github.com/srwiley/oksvg"
+  "github.com/srwiley/rasterx"
+  "golang.org/x/image/bmp"
+  "golang.org/x/image/tiff"
+  "golang.org/x/image/webp"
+)
+
+// ParseResizeMethod maps a user supplied mode to a ResizeMethod, defaulting to Fit
+func ParseResizeMethod(resizeMode string) ResizeMethod {
+  if strings.ToLower(resizeMode) == "fit" {
+    return Fit
+  }
+  if strings.ToLower(resizeMode) == "strech" || strings.ToLower(resizeMode) == "stretch" {
+    return Stretch
+  }
+  if strings.ToLower(resizeMode) == "crop" {
+    return Crop
+  }
+  return Fit
+}
+
+func command_exists(cmd string) bool {
+  _, err := exec.LookPath(cmd)
+  return err == nil
+}
+
+// converts a single page of the document, serving it from the cache when possible
+func convert_page(ctx context.Context, db *bolt.DB, path string, ext string, page int, width int, height int, order []string, cache_max int64) (image.Image, bool, error) {
+  converter, bin, backend_exists := pick_converter(ext, order)
+  if !backend_exists {
+    return nil, false, nil
+  }
+
+  var key []byte
+  if db != nil {
+    var err error
+    key, err = cache_key(path, page, converter.Name)
+    if err != nil {
+      logger.Write(fmt.Sprintf("cache disabled: %v", err))
+    } else if cachedImage := cache_get(db, key); cachedImage != nil {
+      return bytesToImage(cachedImage), true, nil
+    }
+  }
+
+  tmpDir, err := os.MkdirTemp("", "tmp")
+  if err != nil {
+    return nil, true, err
+  }
+  defer os.RemoveAll(tmpDir)
+  cmd := converter.command(ctx, bin, path, ext, page, tmpDir)
+  out, cmdErr := cmd.CombinedOutput()
+  if err := ctx.Err(); err != nil {
+    return nil, true, err
+  }
+  if cmdErr != nil {
+    return nil, true, fmt.Errorf("Error converting page %d with %s: %v: %s", page, converter.Name, cmdErr, strings.TrimSpace(string(out)))
+  }
+
+  new_path, err := converter.output(path, page, tmpDir)
+  if err != nil {
+    return nil, true, err
+  }
+  // some converters exit fine on a page past the end and just write nothing
+  if _, err := os.Stat(new_path); err != nil {
+    return nil, true, fmt.Errorf("Error converting page %d with %s: no page was written", page, converter.Name)
+  }
+  img, err := read_img(file_input(new_path), width, height)
+  if err != nil {
+    return nil, true, err
+  }
+  // put into cache
+  if key != nil {
+    if err := cache_put(db, key, imageToBytes(img), cache_max); err != nil {
+      logger.Write(fmt.Sprintf("failed to cache %s: %v", path, err))
+    }
+  }
+  return img, true, nil
+}
+
+func is_special_doc(ctx context.Context, in input, width int, height int, pages PageRange, layout PageLayout, order []string, should_cache bool, cache_max int64) (image.Image, bool, error) {
+  if in.format == ".ole" {
+    return nil, true, fmt.Errorf("unknown OLE document, name it .doc, .xls or .ppt so it can be converted")
+  }
+  if ext := in.format; is_document(ext) {
+    path, cleanup, err := in.on_disk(ext)
+    if err != nil {
+      return nil, true, err
+    }
+    defer cleanup()
+
+    var db *bolt.DB
+    // a temp file is new every run, caching it would only fill the cache
+    if should_cache && in.data == nil {
+      var err error
+      db, err = open_db()
+      if err != nil {
+        logger.Write(fmt.Sprintf("cache disabled: %v", err))
+        db = nil
+      } else {
+        defer db.Close()
+      }
+    }
+
+    pages = pages.normalized()
+    if pages.Last-pages.First >= maxPages {
+      logger.Write(fmt.Sprintf("rendering pages %d-%d, at most %d pages are rendered at once", pages.First, pages.First+maxPages-1, maxPages))
+      pages.Last = pages.First + maxPages - 1
+    }
+    imgs := []image.Image{}
+    for page := pages.First; page <= pages.Last; page++ {
+      img, backend_exists, err := convert_page(ctx, db, path, ext, page, width, height, order, cache_max)
+      if !backend_exists {
+        return nil, false, nil
+      }
+      // the range may run past the end of the document, which shows the pages up to the last one
+      if err != nil && len(imgs) > 0 && ctx.Err() == nil {
+        logger.Write(fmt.Sprintf("stopping at page %d: %v", page-1, err))
+        break
+      }
+      if err != nil {
+        return nil, true, err
+      }
+      imgs = append(imgs, img)
+    }
+    return compose_pages(imgs, layout), true, nil
+  }
+
+  return nil, true, nil
+}
+
+func read_img(in input, width, height int) (image.Image, error) {
+  r, err := in.open()
+  if err != nil {
+    return nil, err
+  }
+  defer r.Close()
+  return get_content(r, in.format, width, height)
+}
+
+func get_img(ctx context.Context, in input, widthDm Dimension, heightDm Dimension, resizeMode ResizeMethod, pages PageRange, layout PageLayout, converters []string, cache bool, cacheMax int64, autorotate bool, t transform, sSize ScreenSize) (image.Image, error) {
+  width, height := widthDm.GetPixel(sSize), heightDm.GetPixel(sSize)
+
+  img, backend_exists, err := is_special_doc(ctx, in, width, height, pages, layout, converters, cache, cacheMax)
+  if err != nil {
+    return nil, err
+  }
+  if !backend_exists {
+    return nil, fmt.Errorf("can't preview documents, no supported backend is installed")
+  } else if img == nil {
+    img, err = read_img(in, width, height)
+    if err != nil {
+      return nil, err
+    }
+    // turned before resizing, so the sizes are calculated for the upright image
+    if autorotate {
+      img = orient(img, in.exif_orientation())
+    }
+  }
+  img, err = t.apply(img, sSize)
+  if err != nil {
+    return nil, err
+  }
+
+  return ResizeImage(img, uint(width), uint(height), resizeMode)
+}
+
+func decodeSVG(r io.Reader, width, height int) (image.Image, error) {
+  buf := new(bytes.Buffer)
+  _, err := buf.ReadFrom(r)
+  if err != nil {
+    return nil, fmt.Errorf("Error reading SVG file: %v", err)
+  }
+
+  icon, err := oksvg.ReadIconStream(buf)
+  if err != nil {
+    return nil, fmt.Errorf("Error reading SVG icon: %v", err)
+  }
+
+  // Set the target size for the SVG rendering
+  icon.SetTarget(0, 0, float64(width), float64(height))
+
+  // Create a new image and draw the SVG content onto it, the background is left transparent
+  img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+  raster := rasterx.NewDasher(width, height, rasterx.NewScannerGV(width, height, img, img.Bounds()))
+  icon.Draw(raster, 1.0)
+
+  return img, nil
+}
+
+// decodeImage decodes r with the decoder of format, an extension like ".png"
+func decodeImage(r io.Reader, format string, width, height int) (image.Image, error) {
+  formatDecoders := map[string]func(io.Reader) (image.Image, error){
+    ".tif":  tiff.Decode,
+    ".tiff": tiff.Decode,
+    ".webp": webp.Decode,
+    ".bmp":  bmp.Decode,
+    ".gif":  gif.Decode,
+  }
+
+  if decodeFunc, exists := formatDecoders[format]; exists {
+    img, err := decodeFunc(r)
+    if err != nil {
+      return nil, fmt.Errorf("Error decoding %s: %v", format, err)
+    }
+    return img, nil
+  }
+
+  // Handle SVG files
+  if format == ".svg" {
+    img, err := decodeSVG(r, width, height)
+    if err != nil {
+      return nil, fmt.Errorf("Error decoding SVG: %v", err)
+    }
+    return img, nil
+  }
+
+  img, _, err := image.Decode(r)
+  if err != nil {
+    return nil, fmt.Errorf("Error decoding image of unknown format: %v", err)
+  }
+  return img, nil
+}
+
+func get_content(r io.Reader, format string, width, height int) (image.Image, error) {
+  if height == width && width == 0 {
+    width = 200
+    height = 200
+  } else {
+    bigger := width
+    if height > bigger {
+      bigger = height
+    }
+    width = bigger
+    height = bigger
+  }
+
+  return decodeImage(r, format, width, height)
+}
+
+func computeDimensions(origW, origH int, width, height uint) (uint, uint) {
+  if width == 0 && height == 0 {
+    return uint(origW), uint(origH)
+  }
+  if width != 0 && height != 0 {
+    return uint(width), uint(height)
+  }
+  if width == 0 {
+    return uint(math.Round(float64(height) * (float64(origW) / float64(origH)))), height
+  }
+  if height == 0 {
+    return width, uint(math.Round(float64(width) * (float64(origH) / float64(origW))))
+  }
+  return width, height
+}
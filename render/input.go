@@ -0,0 +1,258 @@
+package render
+
+import (
+  "archive/zip"
+  "bytes"
+  "encoding/binary"
+  "fmt"
+  "io"
+  "os"
+  "path/filepath"
+  "slices"
+  "strings"
+)
+
+// input is what gets rendered, a file on disk or data already in memory
+type input struct {
+  path string
+  // data is nil for files, which are read from path
+  data []byte
+  // format is the extension matching the content, like ".png" or ".pdf"
+  format string
+}
+
+func file_input(path string) input {
+  in := input{path: path}
+  in.format = in.sniff(strings.ToLower(filepath.Ext(path)))
+  return in
+}
+
+func data_input(data []byte) input {
+  in := input{data: data}
+  in.format = in.sniff("")
+  return in
+}
+
+// open returns a reader over the whole input
+func (in input) open() (io.ReadCloser, error) {
+  if in.data != nil {
+    return io.NopCloser(bytes.NewReader(in.data)), nil
+  }
+  file, err := os.Open(in.path)
+  if err != nil {
+    return nil, fmt.Errorf("Error opening image: %v", err)
+  }
+  return file, nil
+}
+
+// on_disk returns a path holding the input, for the converters that can only read files.
+// in memory data is written to a temp file with ext, which cleanup removes
+func (in input) on_disk(ext string) (path string, cleanup func(), err error) {
+  if in.data == nil {
+    return in.path, func() {}, nil
+  }
+  file, err := os.CreateTemp("", "ttyimg-*"+ext)
+  if err != nil {
+    return "", nil, err
+  }
+  cleanup = func() { os.Remove(file.Name()) }
+  _, err = file.Write(in.data)
+  if closeErr := file.Close(); err == nil {
+    err = closeErr
+  }
+  if err != nil {
+    cleanup()
+    return "", nil, err
+  }
+  return file.Name(), cleanup, nil
+}
+
+// sniff returns the format of the content, the extension hint is only
+// used when the leading bytes don't tell, or can't tell apart the formats sharing a container
+func (in input) sniff(hint string) string {
+  r, err := in.open()
+  if err != nil {
+    // let decoding report the error
+    return hint
+  }
+  head := make([]byte, 1024)
+  n, _ := io.ReadFull(r, head)
+  r.Close()
+
+  switch ext := sniff_ext(head[:n]); ext {
+  case "":
+    return hint
+  case ".zip":
+    if kind := in.zip_kind(); kind != "" {
+      return kind
+    }
+    return ext
+  case ".ole":
+    // the legacy office formats all share the compound file container,
+    // without a name it stays ".ole" and rendering says so
+    switch hint {
+    case ".doc", ".xls", ".ppt":
+      return hint
+    }
+    return ext
+  default:
+    return ext
+  }
+}
+
+// the leading bytes of each format we can tell apart without decoding,
+// valid checks the rest of the header of formats whose magic is short or shared
+var magic_numbers = []struct {
+  ext    string
+  offset int
+  magic  string
+  valid  func(data []byte) bool
+}{
+  {".png", 0, "\x89PNG\r\n\x1a\n", nil},
+  {".jpg", 0, "\xff\xd8\xff", nil},
+  {".gif", 0, "GIF87a", nil},
+  {".gif", 0, "GIF89a", nil},
+  // riff is also the container of wav and avi
+  {".webp", 8, "WEBP", is_riff},
+  {".bmp", 0, "BM", is_bmp_header},
+  {".tif", 0, "II*\x00", nil},
+  {".tif", 0, "MM\x00*", nil},
+  {".pdf", 0, "%PDF-", nil},
+  {".zip", 0, "PK\x03\x04", nil},
+  {".ole", 0, "\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1", nil},
+}
+
+func is_riff(data []byte) bool {
+  return bytes.HasPrefix(data, []byte("RIFF"))
+}
+
+// the sizes of the dib headers bmp files use, from the os/2 one to BITMAPV5HEADER
+var bmp_dib_sizes = []uint32{12, 40, 52, 56, 64, 108, 124}
+
+// is_bmp_header reports if the file size and the dib header size after "BM" make sense,
+// plenty of text files start with BM too
+func is_bmp_header(data []byte) bool {
+  if len(data) < 18 {
+    return false
+  }
+  fileSize := binary.LittleEndian.Uint32(data[2:6])
+  dibSize := binary.LittleEndian.Uint32(data[14:18])
+  return slices.Contains(bmp_dib_sizes, dibSize) && fileSize >= 14+dibSize
+}
+
+// sniff_ext guesses the extension of data from its leading bytes, "" when unknown.
+// office documents are reported by their container, ".zip" or ".ole"
+func sniff_ext(data []byte) string {
+  for _, m := range magic_numbers {
+    if len(data) < m.offset+len(m.magic) || string(data[m.offset:m.offset+len(m.magic)]) != m.magic {
+      continue
+    }
+    if m.valid == nil || m.valid(data) {
+      return m.ext
+    }
+  }
+
+  if is_svg(data) {
+    return ".svg"
+  }
+  return ""
+}
+
+// the markup that may come before the root element of an xml document, to how it ends
+var xml_prolog = []struct{ start, end string }{
+  {"<?", "?>"},
+  {"<!--", "-->"},
+  {"<!DOCTYPE", ">"},
+}
+
+// is_svg reports if the root element of data is <svg>, skipping the xml declaration,
+// the doctype and the comments before it. svg is text, so there is no magic to go by
+func is_svg(data []byte) bool {
+  data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+  for {
+    data = bytes.TrimLeft(data, " \t\r\n")
+    rest, ok := skip_prolog(data)
+    if !ok {
+      break
+    }
+    data = rest
+  }
+  root, ok := bytes.CutPrefix(data, []byte("<svg"))
+  return ok && (len(root) == 0 || bytes.IndexByte([]byte(" \t\r\n/>"), root[0]) >= 0)
+}
+
+// skip_prolog returns what follows the prolog markup data starts with, false when it
+// starts with something else or the markup doesn't end within data
+func skip_prolog(data []byte) ([]byte, bool) {
+  for _, p := range xml_prolog {
+    rest, ok := bytes.CutPrefix(data, []byte(p.start))
+    if !ok {
+      continue
+    }
+    // a doctype with an internal subset ends after its closing bracket
+    if open, end := bytes.IndexByte(rest, '['), bytes.IndexByte(rest, '>'); p.start == "<!DOCTYPE" && open >= 0 && open < end {
+      closing := bytes.IndexByte(rest, ']')
+      if closing < 0 {
+        return nil, false
+      }
+      rest = rest[closing:]
+    }
+    i := bytes.Index(rest, []byte(p.end))
+    if i < 0 {
+      return nil, false
+    }
+    return rest[i+len(p.end):], true
+  }
+  return nil, false
+}
+
+// the mimetype an odf package stores first, to its extension
+var odf_mimetypes = map[string]string{
+  "application/vnd.oasis.opendocument.text":         ".odt",
+  "application/vnd.oasis.opendocument.spreadsheet":  ".ods",
+  "application/vnd.oasis.opendocument.presentation": ".odp",
+  "application/vnd.oasis.opendocument.graphics":     ".odg",
+}
+
+// the part only the main document of an ooxml package has, to its extension
+var ooxml_parts = map[string]string{
+  "word/document.xml":    ".docx",
+  "xl/workbook.xml":      ".xlsx",
+  "ppt/presentation.xml": ".pptx",
+}
+
+// zip_kind looks inside a zip for the office document it holds, "" when it isn't one
+func (in input) zip_kind() string {
+  var archive *zip.Reader
+  if in.data != nil {
+    var err error
+    archive, err = zip.NewReader(bytes.NewReader(in.data), int64(len(in.data)))
+    if err != nil {
+      return ""
+    }
+  } else {
+    closer, err := zip.OpenReader(in.path)
+    if err != nil {
+      return ""
+    }
+    defer closer.Close()
+    archive = &closer.Reader
+  }
+
+  for _, f := range archive.File {
+    if ext, exists := ooxml_parts[f.Name]; exists {
+      return ext
+    }
+    if f.Name != "mimetype" {
+      continue
+    }
+    r, err := f.Open()
+    if err != nil {
+      return ""
+    }
+    mimetype, _ := io.ReadAll(io.LimitReader(r, 128))
+    r.Close()
+    return odf_mimetypes[strings.TrimSpace(string(mimetype))]
+  }
+  return ""
+}
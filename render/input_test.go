@@ -0,0 +1,301 @@
+package render
+
+import (
+  "archive/zip"
+  "bytes"
+  "context"
+  "encoding/binary"
+  "io"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+)
+
+// bmp_head is the start of a bmp of fileSize bytes with a dib header of dibSize bytes
+func bmp_head(fileSize, dibSize uint32) []byte {
+  head := make([]byte, 14+dibSize)
+  copy(head, "BM")
+  binary.LittleEndian.PutUint32(head[2:], fileSize)
+  binary.LittleEndian.PutUint32(head[10:], 14+dibSize)
+  binary.LittleEndian.PutUint32(head[14:], dibSize)
+  return head
+}
+
+func TestSniffExt(t *testing.T) {
+  tests := []struct {
+    name string
+    data []byte
+    want string
+  }{
+    {"png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), ".png"},
+    {"jpeg", []byte("\xff\xd8\xff\xe0\x00\x10JFIF"), ".jpg"},
+    {"gif", []byte("GIF89a\x10\x00\x10\x00"), ".gif"},
+    {"gif87", []byte("GIF87a\x10\x00\x10\x00"), ".gif"},
+    {"webp", []byte("RIFF\x24\x00\x00\x00WEBPVP8 "), ".webp"},
+    {"webp without riff", []byte("\x00\x00\x00\x00\x24\x00\x00\x00WEBPVP8 "), ""},
+    {"wav", []byte("RIFF\x24\x00\x00\x00WAVEfmt "), ""},
+    {"bmp", bmp_head(1000, 40), ".bmp"},
+    {"bmp v5", bmp_head(1000, 124), ".bmp"},
+    {"os/2 bmp", bmp_head(1000, 12), ".bmp"},
+    {"bmp with an unknown dib header", bmp_head(1000, 41), ""},
+    {"bmp smaller than its header", bmp_head(20, 40), ""},
+    {"text starting with BM", []byte("BMW owners club minutes, march\n"), ""},
+    {"short bm", []byte("BM"), ""},
+    {"tiff", []byte("II*\x00\x08\x00\x00\x00"), ".tif"},
+    {"big endian tiff", []byte("MM\x00*\x00\x00\x00\x08"), ".tif"},
+    {"pdf", []byte("%PDF-1.7\n"), ".pdf"},
+    {"svg", []byte("<svg xmlns=\"http://www.w3.org/2000/svg\"/>"), ".svg"},
+    {"zip", []byte("PK\x03\x04\x14\x00"), ".zip"},
+    {"ole", []byte(ole_magic), ".ole"},
+    {"svg with a prolog", []byte("\xef\xbb\xbf\n<?xml version=\"1.0\"?>\n<svg xmlns=\"http://www.w3.org/2000/svg\"/>"), ".svg"},
+    {"svg with a doctype", []byte("<?xml version=\"1.0\"?>\n<!DOCTYPE svg PUBLIC \"-//W3C//DTD SVG 1.1//EN\" \"http://www.w3.org/Graphics/SVG/1.1/DTD/svg11.dtd\">\n<svg/>"), ".svg"},
+    {"svg with an internal subset", []byte("<!DOCTYPE svg [\n  <!ENTITY ns \"http://www.w3.org/2000/svg\">\n]>\n<svg xmlns=\"&ns;\">"), ".svg"},
+    {"svg after comments", []byte("<!-- Generator: Adobe Illustrator -->\n<!-- <html> -->\n<svg\n  width=\"10\">"), ".svg"},
+    {"svg after a stylesheet", []byte("<?xml version=\"1.0\"?><?xml-stylesheet href=\"a.css\"?><svg>"), ".svg"},
+    {"xml", []byte("<?xml version=\"1.0\"?><note/>"), ""},
+    {"svg inside another root", []byte("<?xml version=\"1.0\"?><html><svg/></html>"), ""},
+    {"svg in a comment", []byte("<!-- <svg> -->\n<note/>"), ""},
+    {"unterminated comment", []byte("<!-- <svg>"), ""},
+    {"element starting with svg", []byte("<svgfont/>"), ""},
+    {"text", []byte("hello"), ""},
+    {"short", []byte("\x89P"), ""},
+    {"empty", nil, ""},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      if got := sniff_ext(tt.data); got != tt.want {
+        t.Errorf("sniff_ext(%q) = %q, want %q", tt.data, got, tt.want)
+      }
+    })
+  }
+}
+
+func TestInputOpen(t *testing.T) {
+  path := test_file(t, "img.png", []byte("on disk"))
+  tests := []struct {
+    name string
+    in   input
+    want string
+  }{
+    {"file", file_input(path), "on disk"},
+    {"data", data_input([]byte("in memory")), "in memory"},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      r, err := tt.in.open()
+      if err != nil {
+        t.Fatal(err)
+      }
+      defer r.Close()
+      if got, _ := io.ReadAll(r); string(got) != tt.want {
+        t.Errorf("read %q, want %q", got, tt.want)
+      }
+    })
+  }
+
+  if _, err := file_input(filepath.Join(t.TempDir(), "missing.png")).open(); err == nil {
+    t.Error("opening a missing file succeeded")
+  }
+}
+
+// zip_file packs files, name to content, into a zip in the order given
+func zip_file(t *testing.T, files ...string) []byte {
+  t.Helper()
+  buf := new(bytes.Buffer)
+  w := zip.NewWriter(buf)
+  for i := 0; i+1 < len(files); i += 2 {
+    f, err := w.Create(files[i])
+    if err != nil {
+      t.Fatal(err)
+    }
+    io.WriteString(f, files[i+1])
+  }
+  if err := w.Close(); err != nil {
+    t.Fatal(err)
+  }
+  return buf.Bytes()
+}
+
+const ole_magic = "\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1"
+
+func TestInputFormat(t *testing.T) {
+  png := test_png(t, 2, 2)
+  docx := zip_file(t, "[Content_Types].xml", "<Types/>", "word/document.xml", "<w:document/>")
+  tests := []struct {
+    name string
+    file string
+    data []byte
+    want string
+  }{
+    {"png", "img.png", png, ".png"},
+    {"png named jpg", "img.jpg", png, ".png"},
+    {"png without an extension", "img", png, ".png"},
+    {"upper case extension", "IMG.PNG", []byte("unknown"), ".png"},
+    {"unknown content keeps the extension", "doc.djvu", []byte("AT&TFORM"), ".djvu"},
+    {"docx", "report.docx", docx, ".docx"},
+    {"docx named zip", "report.zip", docx, ".docx"},
+    {"xlsx", "sheet", zip_file(t, "xl/workbook.xml", "<workbook/>"), ".xlsx"},
+    {"pptx", "slides", zip_file(t, "ppt/presentation.xml", "<presentation/>"), ".pptx"},
+    {"odt", "doc", zip_file(t, "mimetype", "application/vnd.oasis.opendocument.text", "content.xml", "<office/>"), ".odt"},
+    {"ods", "doc", zip_file(t, "mimetype", "application/vnd.oasis.opendocument.spreadsheet"), ".ods"},
+    {"odp", "doc", zip_file(t, "mimetype", "application/vnd.oasis.opendocument.presentation"), ".odp"},
+    {"odg", "doc", zip_file(t, "mimetype", "application/vnd.oasis.opendocument.graphics"), ".odg"},
+    {"plain zip", "archive.docx", zip_file(t, "notes.txt", "hello"), ".zip"},
+    {"xls", "sheet.xls", []byte(ole_magic + "\x00\x00"), ".xls"},
+    {"ppt", "slides.PPT", []byte(ole_magic + "\x00\x00"), ".ppt"},
+    {"ole named otherwise", "doc.bin", []byte(ole_magic + "\x00\x00"), ".ole"},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      if got := file_input(test_file(t, tt.file, tt.data)).format; got != tt.want {
+        t.Errorf("format %q, want %q", got, tt.want)
+      }
+    })
+  }
+}
+
+func TestDataInputFormat(t *testing.T) {
+  tests := []struct {
+    name string
+    data []byte
+    want string
+  }{
+    {"png", test_png(t, 2, 2), ".png"},
+    {"docx", zip_file(t, "word/document.xml", "<w:document/>"), ".docx"},
+    {"odt", zip_file(t, "mimetype", "application/vnd.oasis.opendocument.text"), ".odt"},
+    // data has no name to fall back on
+    {"ole", []byte(ole_magic + "\x00\x00"), ".ole"},
+    {"text", []byte("hello"), ""},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      if got := data_input(tt.data).format; got != tt.want {
+        t.Errorf("format %q, want %q", got, tt.want)
+      }
+    })
+  }
+}
+
+func TestOnDisk(t *testing.T) {
+  path := test_file(t, "doc.pdf", []byte("on disk"))
+  got, cleanup, err := file_input(path).on_disk(".pdf")
+  if err != nil {
+    t.Fatal(err)
+  }
+  cleanup()
+  if got != path {
+    t.Errorf("a file was copied to %s", got)
+  }
+  if _, err := os.Stat(path); err != nil {
+    t.Errorf("cleanup removed the file itself: %v", err)
+  }
+
+  // data is written to a temp file with the extension, for converters that pick by it
+  got, cleanup, err = data_input([]byte("%PDF-1.7\n")).on_disk(".pdf")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if filepath.Ext(got) != ".pdf" {
+    t.Errorf("temp file %s doesn't end in .pdf", got)
+  }
+  if data, _ := os.ReadFile(got); string(data) != "%PDF-1.7\n" {
+    t.Errorf("temp file holds %q", data)
+  }
+  cleanup()
+  if _, err := os.Stat(got); !os.IsNotExist(err) {
+    t.Errorf("cleanup left %s behind", got)
+  }
+}
+
+func TestRenderReader(t *testing.T) {
+  tests := []struct {
+    name string
+    data []byte
+    // the kitty actions written
+    want string
+  }{
+    {"png", test_png(t, 64, 48), "T"},
+    {"animated gif", test_gif(t, 8, 8, 3, 0), "T,f,f,a,a"},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      out := new(bytes.Buffer)
+      if err := RenderReader(context.Background(), out, bytes.NewReader(tt.data), test_options(Kitty)); err != nil {
+        t.Fatal(err)
+      }
+      var actions []string
+      for _, cmd := range kitty_commands(out.String()) {
+        // continuation chunks only carry m=
+        if cmd["a"] != "" {
+          actions = append(actions, cmd["a"])
+        }
+      }
+      if got := strings.Join(actions, ","); got != tt.want {
+        t.Errorf("actions %s, want %s", got, tt.want)
+      }
+    })
+  }
+
+  if err := RenderReader(context.Background(), new(bytes.Buffer), bytes.NewReader(nil), test_options(Kitty)); err == nil {
+    t.Error("rendering no data succeeded")
+  }
+  if err := RenderReader(context.Background(), new(bytes.Buffer), strings.NewReader("hello"), test_options(Kitty)); err == nil {
+    t.Error("rendering text succeeded")
+  }
+}
+
+func TestRenderReaderDocument(t *testing.T) {
+  with_cache(t)
+  runs := stub_libreoffice(t, 30, 40)
+  opts := test_options(Blocks)
+  opts.Converters = []string{"libreoffice"}
+  opts.Cache = true
+
+  // a pdf is converted from a temp file, which isn't cached since it is new every run
+  for i := 1; i <= 2; i++ {
+    if err := RenderReader(context.Background(), new(bytes.Buffer), strings.NewReader("%PDF-1.7\n"), opts); err != nil {
+      t.Fatal(err)
+    }
+    if got := len(runs()); got != i {
+      t.Errorf("converted %d times after %d renders", got, i)
+    }
+  }
+  if keys := cached_keys(t); len(keys) != 0 {
+    t.Errorf("cached %q", keys)
+  }
+  if temps, _ := filepath.Glob(filepath.Join(os.TempDir(), "ttyimg-*.pdf")); len(temps) != 0 {
+    t.Errorf("temp files left behind: %v", temps)
+  }
+}
+
+func TestRenderStdin(t *testing.T) {
+  r, w, err := os.Pipe()
+  if err != nil {
+    t.Fatal(err)
+  }
+  stdin := os.Stdin
+  os.Stdin = r
+  t.Cleanup(func() { os.Stdin = stdin })
+  png := test_png(t, 64, 48)
+  go func() {
+    w.Write(png)
+    w.Close()
+  }()
+
+  out := new(bytes.Buffer)
+  if err := Render(context.Background(), out, "-", test_options(Kitty)); err != nil {
+    t.Fatal(err)
+  }
+  if cmds := kitty_commands(out.String()); len(cmds) == 0 || cmds[0]["a"] != "T" {
+    t.Errorf("stdin wasn't rendered: %v", cmds)
+  }
+}
+
+func TestRenderUnknownOLE(t *testing.T) {
+  // the legacy office formats share a container, only the name tells them apart
+  err := RenderReader(context.Background(), new(bytes.Buffer), strings.NewReader(ole_magic+"\x00\x00"), test_options(Kitty))
+  if err == nil || !strings.Contains(err.Error(), "unknown OLE document") {
+    t.Errorf("got error %v, want an unknown OLE document", err)
+  }
+}
@@ -1,4 +1,4 @@
-package main
+package render
 
 import (
   "fmt"
@@ -8,10 +8,11 @@ import (
   "time"
 )
 
-func get_log_path() string {
-  exePath, _ := os.Executable()
-  exeDir := filepath.Dir(exePath)
-  return filepath.Join(exeDir, "logs.log")
+var logger = &Logger{}
+
+// SetLogger routes the package's diagnostic messages to l
+func SetLogger(l *Logger) {
+  logger = l
 }
 
 type Logger struct {
@@ -0,0 +1,97 @@
+package render
+
+import (
+  "fmt"
+  "image"
+  "image/draw"
+  "math"
+  "regexp"
+  "strconv"
+  "strings"
+)
+
+type PageLayout string
+
+const (
+  Stack PageLayout = "stack"
+  Grid  PageLayout = "grid"
+)
+
+// space between the pages of a range, in px
+const pageGap = 8
+
+// the most pages a range renders, every page is converted and held in memory at full resolution
+const maxPages = 16
+
+// PageRange selects the pages of a document to render, both ends inclusive and 1 based
+type PageRange struct {
+  First int
+  Last  int
+}
+
+// ParsePageRange parses a page number, e.g 3, or a range, e.g 2-5
+func ParsePageRange(input string) (PageRange, error) {
+  matches := regexp.MustCompile(`^(\d+)(?:-(\d+))?$`).FindStringSubmatch(strings.TrimSpace(input))
+  if matches == nil {
+    return PageRange{}, fmt.Errorf("invalid page: %s", input)
+  }
+  first, _ := strconv.Atoi(matches[1])
+  last := first
+  if matches[2] != "" {
+    last, _ = strconv.Atoi(matches[2])
+  }
+  if first < 1 || last < first {
+    return PageRange{}, fmt.Errorf("invalid page range: %s", input)
+  }
+  return PageRange{First: first, Last: last}, nil
+}
+
+// ParsePageLayout maps a user supplied layout to a PageLayout, defaulting to Stack
+func ParsePageLayout(layout string) PageLayout {
+  if strings.ToLower(layout) == "grid" {
+    return Grid
+  }
+  return Stack
+}
+
+// normalized returns the range with the zero value meaning the first page
+func (p PageRange) normalized() PageRange {
+  if p.First < 1 {
+    p.First = 1
+  }
+  if p.Last < p.First {
+    p.Last = p.First
+  }
+  return p
+}
+
+// compose_pages lays the pages out into a single image, one under the other or as a grid
+func compose_pages(pages []image.Image, layout PageLayout) image.Image {
+  if len(pages) == 1 {
+    return pages[0]
+  }
+
+  cols := 1
+  if layout == Grid {
+    cols = int(math.Ceil(math.Sqrt(float64(len(pages)))))
+  }
+  rows := (len(pages) + cols - 1) / cols
+
+  // every cell is as big as the biggest page
+  cellW, cellH := 0, 0
+  for _, page := range pages {
+    cellW = max(cellW, page.Bounds().Dx())
+    cellH = max(cellH, page.Bounds().Dy())
+  }
+
+  canvas := image.NewRGBA(image.Rect(0, 0, cols*cellW+(cols-1)*pageGap, rows*cellH+(rows-1)*pageGap))
+  for i, page := range pages {
+    x := (i % cols) * (cellW + pageGap)
+    y := (i / cols) * (cellH + pageGap)
+    bounds := page.Bounds()
+    dst := image.Rect(x, y, x+bounds.Dx(), y+bounds.Dy())
+    draw.Draw(canvas, dst, page, bounds.Min, draw.Src)
+  }
+
+  return canvas
+}
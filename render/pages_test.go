@@ -0,0 +1,219 @@
+package render
+
+import (
+  "context"
+  "fmt"
+  "image"
+  "image/color"
+  "os"
+  "path/filepath"
+  "runtime"
+  "strconv"
+  "strings"
+  "testing"
+)
+
+// flat_page is a w x h page of a single color
+func flat_page(w, h int, c color.Color) image.Image {
+  img := image.NewRGBA(image.Rect(0, 0, w, h))
+  for y := 0; y < h; y++ {
+    for x := 0; x < w; x++ {
+      img.Set(x, y, c)
+    }
+  }
+  return img
+}
+
+func TestDocumentPages(t *testing.T) {
+  runs := stub_libreoffice(t, 30, 40)
+  doc := test_file(t, "doc.odt", []byte("document"))
+
+  img, exists, err := is_special_doc(context.Background(), file_input(doc), 10, 10, PageRange{1, 3}, Stack, nil, false, 0)
+  if err != nil || !exists {
+    t.Fatalf("got %v, %v", exists, err)
+  }
+  // stacked pages are separated by pageGap
+  if got, want := img.Bounds().Dy(), 3*40+2*pageGap; got != want {
+    t.Errorf("height %d, want %d for 3 pages", got, want)
+  }
+
+  want := fmt.Sprint([]string{
+    "png",
+    `png:writer_png_Export:{"PageRange":{"type":"string","value":"2"}}`,
+    `png:writer_png_Export:{"PageRange":{"type":"string","value":"3"}}`,
+  })
+  if got := fmt.Sprint(runs()); got != want {
+    t.Errorf("converted with %s, want %s", got, want)
+  }
+}
+
+func TestComposePages(t *testing.T) {
+  red := color.RGBA{0xff, 0, 0, 0xff}
+  blue := color.RGBA{0, 0, 0xff, 0xff}
+  pages := func(n int) []image.Image {
+    imgs := []image.Image{flat_page(20, 30, red)}
+    for i := 1; i < n; i++ {
+      imgs = append(imgs, flat_page(10, 10, blue))
+    }
+    return imgs
+  }
+
+  tests := []struct {
+    name   string
+    pages  int
+    layout PageLayout
+    want   image.Point
+    // where the last page starts
+    last image.Point
+  }{
+    {"single page", 1, Grid, image.Pt(20, 30), image.Pt(0, 0)},
+    {"stack", 3, Stack, image.Pt(20, 3*30+2*pageGap), image.Pt(0, 2*(30+pageGap))},
+    {"square grid", 4, Grid, image.Pt(2*20+pageGap, 2*30+pageGap), image.Pt(20+pageGap, 30+pageGap)},
+    {"partial grid", 5, Grid, image.Pt(3*20+2*pageGap, 2*30+pageGap), image.Pt(20+pageGap, 30+pageGap)},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      img := compose_pages(pages(tt.pages), tt.layout)
+      if got := img.Bounds().Size(); got != tt.want {
+        t.Errorf("size %v, want %v", got, tt.want)
+      }
+      if got := color.RGBAModel.Convert(img.At(0, 0)); got != red {
+        t.Errorf("first page at the origin is %v, want %v", got, red)
+      }
+      if tt.pages > 1 {
+        if got := color.RGBAModel.Convert(img.At(tt.last.X, tt.last.Y)); got != blue {
+          t.Errorf("last page at %v is %v, want %v", tt.last, got, blue)
+        }
+        // pages smaller than their cell leave the rest of it empty
+        if got := color.RGBAModel.Convert(img.At(tt.last.X+10, tt.last.Y)); got == blue {
+          t.Errorf("last page spills past its size at %v", tt.last)
+        }
+      }
+    })
+  }
+}
+
+// stub_converter registers a converter named name that runs a script on PATH,
+// it writes a w x h png for the pages up to last and fails past them like pdftoppm does.
+// it returns the path of the png the script copies
+func stub_converter(t *testing.T, name string, w, h, last int) string {
+  t.Helper()
+  if runtime.GOOS == "windows" {
+    t.Skip("stub converters are shell scripts")
+  }
+  dir := t.TempDir()
+  png := filepath.Join(dir, "page.png")
+  if err := os.WriteFile(png, test_png(t, w, h), 0644); err != nil {
+    t.Fatal(err)
+  }
+  script := fmt.Sprintf("#!/bin/sh\nif [ \"$1\" -gt %d ]; then echo 'Wrong page range given' >&2; exit 99; fi\ncp %s \"$2/page.png\"\n", last, png)
+  if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+    t.Fatal(err)
+  }
+  t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+  with_registry(t)
+  RegisterConverter(Converter{
+    Name:     name,
+    Exts:     []string{".pdf"},
+    Binaries: []string{name},
+    Args: func(path string, ext string, page int, outDir string) []string {
+      return []string{strconv.Itoa(page), outDir}
+    },
+  })
+  return png
+}
+
+func TestPageRangeStopsAtLastPage(t *testing.T) {
+  stub_converter(t, "stub-pages", 30, 40, 2)
+  doc := data_input([]byte("%PDF-1.4\n"))
+
+  tests := []struct {
+    name  string
+    pages PageRange
+    // pages rendered, 0 for an error
+    want int
+  }{
+    {"first page", PageRange{1, 1}, 1},
+    {"whole document", PageRange{1, 2}, 2},
+    {"past the end", PageRange{2, 5}, 1},
+    {"huge range", PageRange{1, 1 << 30}, 2},
+    {"only past the end", PageRange{3, 4}, 0},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      img, backend_exists, err := is_special_doc(context.Background(), doc, 0, 0, tt.pages, Stack, []string{"stub-pages"}, false, 0)
+      if !backend_exists {
+        t.Fatal("stub converter not found")
+      }
+      if tt.want == 0 {
+        if err == nil || !strings.Contains(err.Error(), "Wrong page range given") {
+          t.Fatalf("got error %v, want the converter's", err)
+        }
+        return
+      }
+      if err != nil {
+        t.Fatal(err)
+      }
+      // stacked pages are separated by pageGap
+      if got, want := img.Bounds().Dy(), tt.want*40+(tt.want-1)*pageGap; got != want {
+        t.Errorf("height %d, want %d for %d pages", got, want, tt.want)
+      }
+    })
+  }
+}
+
+func TestParsePageRange(t *testing.T) {
+  tests := []struct {
+    input   string
+    want    PageRange
+    wantErr bool
+  }{
+    {"1", PageRange{1, 1}, false},
+    {"3", PageRange{3, 3}, false},
+    {" 2-5 ", PageRange{2, 5}, false},
+    {"4-4", PageRange{4, 4}, false},
+    {"0", PageRange{}, true},
+    {"0-2", PageRange{}, true},
+    {"5-2", PageRange{}, true},
+    {"-2", PageRange{}, true},
+    {"2-", PageRange{}, true},
+    {"1,3", PageRange{}, true},
+    {"first", PageRange{}, true},
+    {"", PageRange{}, true},
+  }
+  for _, tt := range tests {
+    t.Run(tt.input, func(t *testing.T) {
+      got, err := ParsePageRange(tt.input)
+      if tt.wantErr {
+        if err == nil {
+          t.Errorf("ParsePageRange(%q) = %v, want an error", tt.input, got)
+        }
+        return
+      }
+      if err != nil || got != tt.want {
+        t.Errorf("ParsePageRange(%q) = %v, %v, want %v", tt.input, got, err, tt.want)
+      }
+    })
+  }
+}
+
+func TestParsePageLayout(t *testing.T) {
+  tests := []struct {
+    input string
+    want  PageLayout
+  }{
+    {"grid", Grid},
+    {"GRID", Grid},
+    {"stack", Stack},
+    {"", Stack},
+    {"columns", Stack},
+  }
+  for _, tt := range tests {
+    t.Run(tt.input, func(t *testing.T) {
+      if got := ParsePageLayout(tt.input); got != tt.want {
+        t.Errorf("ParsePageLayout(%q) = %q, want %q", tt.input, got, tt.want)
+      }
+    })
+  }
+}
@@ -0,0 +1,158 @@
+package render
+
+import (
+  "bytes"
+  "fmt"
+  "image"
+  "io"
+  "os"
+  "strconv"
+  "strings"
+  "time"
+)
+
+// Passthrough is how graphics get past a terminal multiplexer to the real terminal
+type Passthrough string
+
+const (
+  // PassthroughAuto wraps when $TMUX or $STY is set
+  PassthroughAuto Passthrough = "auto"
+  Tmux            Passthrough = "tmux"
+  Screen          Passthrough = "screen"
+  NoPassthrough   Passthrough = "none"
+)
+
+// tmux buffers at most 1MB of a passthrough sequence, screen a few hundred bytes
+const (
+  tmuxChunkSize   = 64 * 1024
+  screenChunkSize = 768
+)
+
+// ParsePassthrough maps a user supplied multiplexer to a Passthrough
+func ParsePassthrough(passthrough string) (Passthrough, error) {
+  switch p := Passthrough(strings.ToLower(passthrough)); p {
+  case PassthroughAuto, Tmux, Screen, NoPassthrough:
+    return p, nil
+  }
+  return "", fmt.Errorf("invalid passthrough '%s'. Must be auto, tmux, screen or none", passthrough)
+}
+
+// resolve turns auto into the multiplexer we are running in, if any
+func (p Passthrough) resolve() Passthrough {
+  if p != PassthroughAuto && p != "" {
+    return p
+  }
+  if os.Getenv("TMUX") != "" {
+    return Tmux
+  }
+  if os.Getenv("STY") != "" {
+    return Screen
+  }
+  return NoPassthrough
+}
+
+// wrap returns seq wrapped in as many passthrough sequences as the multiplexer needs
+func (p Passthrough) wrap(seq []byte) []byte {
+  buf := new(bytes.Buffer)
+  switch p {
+  case Tmux:
+    // tmux wants every escape inside doubled, so chunks can be cut anywhere
+    for len(seq) > 0 {
+      chunk := seq[:min(len(seq), tmuxChunkSize)]
+      seq = seq[len(chunk):]
+      buf.WriteString("\x1bPtmux;")
+      buf.Write(bytes.ReplaceAll(chunk, []byte("\x1b"), []byte("\x1b\x1b")))
+      buf.WriteString("\x1b\\")
+    }
+  case Screen:
+    // screen passes the content as is, so a string terminator inside would end the wrapper,
+    // cutting the chunk right after its escape hands it over in two halves
+    for len(seq) > 0 {
+      end := min(len(seq), screenChunkSize)
+      if i := bytes.Index(seq[:end], []byte("\x1b\\")); i >= 0 {
+        end = i + 1
+      }
+      buf.WriteString("\x1bP")
+      buf.Write(seq[:end])
+      buf.WriteString("\x1b\\")
+      seq = seq[end:]
+    }
+  default:
+    buf.Write(seq)
+  }
+  return buf.Bytes()
+}
+
+// write hands payload to the outer terminal, flushing out first so the
+// multiplexer has moved the cursor before the payload arrives
+func (p Passthrough) write(out io.Writer, payload []byte) error {
+  if p == NoPassthrough {
+    _, err := out.Write(payload)
+    return err
+  }
+  if f, ok := out.(interface{ Flush() error }); ok {
+    if err := f.Flush(); err != nil {
+      return err
+    }
+  }
+  _, err := out.Write(p.wrap(payload))
+  return err
+}
+
+// wrapEncoder returns encode with its output passed through the multiplexer
+func (p Passthrough) wrapEncoder(encode func(io.Writer, image.Image) error) func(io.Writer, image.Image) error {
+  if p == NoPassthrough {
+    return encode
+  }
+  return func(out io.Writer, img image.Image) error {
+    buf := new(bytes.Buffer)
+    if err := encode(buf, img); err != nil {
+      return err
+    }
+    return p.write(out, buf.Bytes())
+  }
+}
+
+// asks the terminal, through p, which graphics protocols it understands in one round trip.
+// the kitty query is only sent when kitty is set, sixel support comes from the sentinel's device attributes
+func query_graphics(p Passthrough, kitty bool, timeout time.Duration) (isKitty bool, isSixel bool) {
+  queries := []string{}
+  if kitty {
+    queries = append(queries, "\x1b_Gi=31,s=1,v=1,a=q,t=d,f=24;AAAA\x1b\\")
+  }
+  replies, err := query_terminal(p, timeout, queries...)
+  if err != nil {
+    logger.Write(fmt.Sprintf("graphics query: %v", err))
+  }
+
+  //\x1b_Gi=31;OK\x1b\\
+  if response, ok := find_string(replies, '_', "G"); ok {
+    isKitty = strings.Contains(response, "i=31;OK")
+  }
+  //\x1b[?62;4;22c
+  if attrs, ok := find_csi(replies, "?", 'c'); ok {
+    for i, attr := range attrs {
+      // the first one is the terminal id rather than a feature
+      if i > 0 && attr == "4" {
+        isSixel = true
+      }
+    }
+  }
+  return isKitty, isSixel
+}
+
+// asks the outer terminal for the size of a cell in px, the multiplexer only knows cells
+func get_cell_size_passthrough(p Passthrough, timeout time.Duration) (int, int, error) {
+  replies, err := query_terminal(p, timeout, "\x1b[16t")
+  //\x1b[6;17;8t
+  parts, ok := find_csi(replies, "6;", 't')
+  if !ok || len(parts) < 3 {
+    return 0, 0, fmt.Errorf("no cell size response: %v", err)
+  }
+  height, errH := strconv.Atoi(parts[1])
+  width, errW := strconv.Atoi(parts[2])
+  if errH != nil || errW != nil {
+    return 0, 0, fmt.Errorf("unexpected cell size response: %q", parts)
+  }
+  return width, height, nil
+}
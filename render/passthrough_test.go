@@ -0,0 +1,199 @@
+package render
+
+import (
+  "bufio"
+  "bytes"
+  "context"
+  "image"
+  "io"
+  "strings"
+  "testing"
+)
+
+// unwrap_tmux undoes Tmux.wrap, failing the test when a chunk is malformed
+func unwrap_tmux(t *testing.T, wrapped string) (string, int) {
+  t.Helper()
+  chunks := strings.Split(wrapped, "\x1bPtmux;")
+  if chunks[0] != "" {
+    t.Fatalf("output doesn't start with a passthrough: %q", wrapped[:min(len(wrapped), 20)])
+  }
+  seq := ""
+  for _, chunk := range chunks[1:] {
+    body, found := strings.CutSuffix(chunk, "\x1b\\")
+    if !found {
+      t.Fatalf("chunk isn't terminated: %q", chunk[max(0, len(chunk)-20):])
+    }
+    // every escape inside is doubled, so a lone one would end the passthrough early
+    if strings.Contains(strings.ReplaceAll(body, "\x1b\x1b", ""), "\x1b") {
+      t.Fatalf("chunk holds an undoubled escape")
+    }
+    seq += strings.ReplaceAll(body, "\x1b\x1b", "\x1b")
+  }
+  return seq, len(chunks) - 1
+}
+
+func TestParsePassthrough(t *testing.T) {
+  tests := []struct {
+    input   string
+    want    Passthrough
+    wantErr bool
+  }{
+    {"auto", PassthroughAuto, false},
+    {"tmux", Tmux, false},
+    {"Screen", Screen, false},
+    {"NONE", NoPassthrough, false},
+    {"zellij", "", true},
+    {"", "", true},
+  }
+  for _, tt := range tests {
+    t.Run(tt.input, func(t *testing.T) {
+      got, err := ParsePassthrough(tt.input)
+      if tt.wantErr {
+        if err == nil {
+          t.Errorf("ParsePassthrough(%q) = %q, want an error", tt.input, got)
+        }
+        return
+      }
+      if err != nil || got != tt.want {
+        t.Errorf("ParsePassthrough(%q) = %q, %v, want %q", tt.input, got, err, tt.want)
+      }
+    })
+  }
+}
+
+func TestResolvePassthrough(t *testing.T) {
+  tests := []struct {
+    name string
+    p    Passthrough
+    tmux string
+    sty  string
+    want Passthrough
+  }{
+    {"tmux", PassthroughAuto, "/tmp/tmux-1000/default,1,0", "", Tmux},
+    {"screen", PassthroughAuto, "", "1234.pts-0.host", Screen},
+    {"tmux inside screen", PassthroughAuto, "/tmp/tmux", "1234.pts-0.host", Tmux},
+    {"no multiplexer", PassthroughAuto, "", "", NoPassthrough},
+    {"zero value is auto", "", "/tmp/tmux", "", Tmux},
+    {"forced", Screen, "/tmp/tmux", "", Screen},
+    {"disabled", NoPassthrough, "/tmp/tmux", "", NoPassthrough},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      t.Setenv("TMUX", tt.tmux)
+      t.Setenv("STY", tt.sty)
+      if got := tt.p.resolve(); got != tt.want {
+        t.Errorf("got %q, want %q", got, tt.want)
+      }
+    })
+  }
+}
+
+func TestWrapTmux(t *testing.T) {
+  tests := []struct {
+    name   string
+    seq    string
+    chunks int
+  }{
+    {"short", "\x1b_Ga=T;AAAA\x1b\\", 1},
+    {"one full chunk", strings.Repeat("A", tmuxChunkSize), 1},
+    {"escape on the chunk boundary", strings.Repeat("A", tmuxChunkSize-1) + "\x1b\\" + strings.Repeat("B", 10), 2},
+    {"many chunks", strings.Repeat("\x1b_GAAAA\x1b\\", tmuxChunkSize/4), 3},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      seq, chunks := unwrap_tmux(t, string(Tmux.wrap([]byte(tt.seq))))
+      if chunks != tt.chunks {
+        t.Errorf("%d chunks, want %d", chunks, tt.chunks)
+      }
+      if seq != tt.seq {
+        t.Error("unwrapping didn't give the sequence back")
+      }
+    })
+  }
+
+  if got, want := string(Tmux.wrap([]byte("\x1b[c"))), "\x1bPtmux;\x1b\x1b[c\x1b\\"; got != want {
+    t.Errorf("got %q, want %q", got, want)
+  }
+}
+
+func TestWrapScreen(t *testing.T) {
+  tests := []struct {
+    name string
+    seq  string
+    want []string
+  }{
+    {"short", "\x1b[c", []string{"\x1b[c"}},
+    {"768 byte chunks", strings.Repeat("A", 2000), []string{strings.Repeat("A", 768), strings.Repeat("A", 768), strings.Repeat("A", 464)}},
+    {"split at the terminator", "\x1b_Ga=T;AAAA\x1b\\", []string{"\x1b_Ga=T;AAAA\x1b", "\\"}},
+    {"terminator on the chunk boundary", strings.Repeat("A", 767) + "\x1b\\B", []string{strings.Repeat("A", 767) + "\x1b", "\\B"}},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      want := ""
+      for _, chunk := range tt.want {
+        want += "\x1bP" + chunk + "\x1b\\"
+      }
+      if got := string(Screen.wrap([]byte(tt.seq))); got != want {
+        t.Errorf("got %q, want %q", got, want)
+      }
+    })
+  }
+}
+
+func TestWrapNone(t *testing.T) {
+  seq := "\x1b_Ga=T;AAAA\x1b\\"
+  if got := string(NoPassthrough.wrap([]byte(seq))); got != seq {
+    t.Errorf("got %q, want it unchanged", got)
+  }
+}
+
+func TestPassthroughWrite(t *testing.T) {
+  out := new(bytes.Buffer)
+  w := bufio.NewWriter(out)
+  // what is buffered reaches the terminal before the payload does
+  w.WriteString("\x1b[2C")
+  if err := Screen.write(w, []byte("img")); err != nil {
+    t.Fatal(err)
+  }
+  w.Flush()
+  if got, want := out.String(), "\x1b[2C\x1bPimg\x1b\\"; got != want {
+    t.Errorf("got %q, want %q", got, want)
+  }
+
+  encode := Tmux.wrapEncoder(func(out io.Writer, img image.Image) error {
+    _, err := io.WriteString(out, "\x1b_G;\x1b\\")
+    return err
+  })
+  out.Reset()
+  if err := encode(out, nil); err != nil {
+    t.Fatal(err)
+  }
+  if got, want := out.String(), "\x1bPtmux;\x1b\x1b_G;\x1b\x1b\\\x1b\\"; got != want {
+    t.Errorf("got %q, want %q", got, want)
+  }
+}
+
+func TestRenderPassthrough(t *testing.T) {
+  path := test_file(t, "img.png", test_png(t, 64, 48))
+  opts := test_options(Kitty)
+  opts.Passthrough = Tmux
+  out := new(bytes.Buffer)
+  if err := Render(context.Background(), out, path, opts); err != nil {
+    t.Fatal(err)
+  }
+  // the multiplexer doesn't know the image is there, rows are reserved before and skipped after it
+  start := strings.Index(out.String(), "\x1bPtmux;")
+  end := strings.LastIndex(out.String(), "\x1b\\")
+  if start < 0 || end < start {
+    t.Fatalf("image wasn't passed through: %q", out.String())
+  }
+  if !strings.HasPrefix(out.String(), "\n") || !strings.Contains(out.String()[:start], "A") {
+    t.Errorf("rows weren't reserved before the image: %q", out.String()[:start])
+  }
+  if !strings.HasSuffix(out.String(), "B\n") {
+    t.Errorf("cursor wasn't moved past the image: %q", out.String()[end:])
+  }
+  if _, chunks := unwrap_tmux(t, out.String()[start:end+2]); chunks != 1 {
+    t.Errorf("%d passthrough chunks, want 1", chunks)
+  }
+}
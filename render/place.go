@@ -0,0 +1,49 @@
+package render
+
+import (
+  "fmt"
+  "regexp"
+  "strconv"
+)
+
+// Place is a rectangle of the screen in cells, like the one file managers give previewers
+type Place struct {
+  Cols, Rows int
+  // X and Y of the top left cell, counted from 0
+  X, Y int
+}
+
+// ParsePlace parses WxH@X,Y in cells, an empty string is the zero Place
+func ParsePlace(place string) (Place, error) {
+  if place == "" {
+    return Place{}, nil
+  }
+  matches := regexp.MustCompile(`^(\d+)x(\d+)@(\d+),(\d+)$`).FindStringSubmatch(place)
+  if matches == nil {
+    return Place{}, fmt.Errorf("invalid place '%s'. Must be <width>x<height>@<x>,<y> in cells", place)
+  }
+  var p Place
+  p.Cols, _ = strconv.Atoi(matches[1])
+  p.Rows, _ = strconv.Atoi(matches[2])
+  p.X, _ = strconv.Atoi(matches[3])
+  p.Y, _ = strconv.Atoi(matches[4])
+  if p.Cols == 0 || p.Rows == 0 {
+    return Place{}, fmt.Errorf("invalid place '%s'. Must be at least 1x1", place)
+  }
+  return p, nil
+}
+
+// set reports if the place was given, the zero Place means the image goes wherever it flows
+func (p Place) set() bool {
+  return p.Cols > 0 && p.Rows > 0
+}
+
+// area returns the size of the rectangle, measured with the cells of sSize
+func (p Place) area(sSize ScreenSize) ScreenSize {
+  cellW, cellH := 1, 1
+  if sSize.widthCell > 0 && sSize.heightCell > 0 {
+    cellW = max(sSize.widthPx/sSize.widthCell, 1)
+    cellH = max(sSize.heightPx/sSize.heightCell, 1)
+  }
+  return ScreenSize{widthPx: p.Cols * cellW, heightPx: p.Rows * cellH, widthCell: p.Cols, heightCell: p.Rows}
+}
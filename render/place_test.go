@@ -0,0 +1,116 @@
+package render
+
+import (
+  "bytes"
+  "context"
+  "strings"
+  "testing"
+)
+
+func TestParsePlace(t *testing.T) {
+  tests := []struct {
+    input   string
+    want    Place
+    wantErr bool
+  }{
+    {"", Place{}, false},
+    {"40x20@0,0", Place{Cols: 40, Rows: 20}, false},
+    {"80x24@10,5", Place{Cols: 80, Rows: 24, X: 10, Y: 5}, false},
+    {"0x20@0,0", Place{}, true},
+    {"40x0@0,0", Place{}, true},
+    {"40x20", Place{}, true},
+    {"40x20@-1,0", Place{}, true},
+    {"40x20@1;2", Place{}, true},
+    {" 40x20@0,0", Place{}, true},
+  }
+  for _, tt := range tests {
+    t.Run(tt.input, func(t *testing.T) {
+      got, err := ParsePlace(tt.input)
+      if tt.wantErr {
+        if err == nil {
+          t.Errorf("ParsePlace(%q) = %v, want an error", tt.input, got)
+        }
+        return
+      }
+      if err != nil || got != tt.want {
+        t.Errorf("ParsePlace(%q) = %v, %v, want %v", tt.input, got, err, tt.want)
+      }
+    })
+  }
+}
+
+func TestPlaceArea(t *testing.T) {
+  place := Place{Cols: 10, Rows: 4, X: 5, Y: 2}
+  tests := []struct {
+    name  string
+    sSize ScreenSize
+    want  ScreenSize
+  }{
+    {"10 x 15 px cells", ScreenSize{widthPx: 400, heightPx: 300, widthCell: 40, heightCell: 20}, ScreenSize{widthPx: 100, heightPx: 60, widthCell: 10, heightCell: 4}},
+    {"unknown cells are a px", ScreenSize{}, ScreenSize{widthPx: 10, heightPx: 4, widthCell: 10, heightCell: 4}},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      if got := place.area(tt.sSize); got != tt.want {
+        t.Errorf("got %+v, want %+v", got, tt.want)
+      }
+    })
+  }
+}
+
+func TestRenderPlaced(t *testing.T) {
+  path := test_file(t, "img.png", test_png(t, 100, 60))
+  tests := []struct {
+    name  string
+    place Place
+    align Align
+    // how the output starts, saving the cursor and moving to the image
+    want string
+  }{
+    {"top left of the place", Place{Cols: 10, Rows: 10, X: 5, Y: 3}, AlignInline, "\x1b7\r\x1b[4d\x1b[5C\x1b_G"},
+    {"aligned in the place", Place{Cols: 20, Rows: 10, X: 5, Y: 3}, "center", "\x1b7\r\x1b[7d\x1b[10C\x1b_G"},
+    {"at the origin", Place{Cols: 10, Rows: 10}, AlignInline, "\x1b7\r\x1b[1d\x1b_G"},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      opts := test_options(Kitty)
+      opts.Place = tt.place
+      opts.Align = tt.align
+      out := new(bytes.Buffer)
+      if err := Render(context.Background(), out, path, opts); err != nil {
+        t.Fatal(err)
+      }
+      if !strings.HasPrefix(out.String(), tt.want) {
+        t.Errorf("output starts %q, want %q", out.String()[:min(out.Len(), 40)], tt.want)
+      }
+      // the cursor goes back where it was, without a newline scrolling the screen
+      if !strings.HasSuffix(out.String(), "\x1b\\\x1b8") {
+        t.Errorf("cursor wasn't restored: %q", out.String()[max(out.Len()-20, 0):])
+      }
+    })
+  }
+}
+
+func TestRenderPlacedText(t *testing.T) {
+  // plain text moves its lines with spaces inline, but placed it would blank the screen left of it
+  path := test_file(t, "img.png", test_png(t, 100, 60))
+  for _, protocol := range []Protocol{Braille, Ascii} {
+    t.Run(string(protocol), func(t *testing.T) {
+      opts := test_options(protocol)
+      opts.Place = Place{Cols: 10, Rows: 10, X: 5, Y: 3}
+      out := new(bytes.Buffer)
+      if err := Render(context.Background(), out, path, opts); err != nil {
+        t.Fatal(err)
+      }
+      body, ok := strings.CutPrefix(out.String(), "\x1b7\r\x1b[4d")
+      if !ok {
+        t.Fatalf("output starts %q", out.String()[:min(out.Len(), 20)])
+      }
+      for i, line := range strings.Split(strings.TrimSuffix(body, "\x1b8"), "\n") {
+        if !strings.HasPrefix(line, "\x1b[5C") {
+          t.Errorf("line %d is %q, want it moved with an escape", i, line)
+        }
+      }
+    })
+  }
+}
@@ -0,0 +1,136 @@
+package render
+
+import (
+  "bytes"
+  "context"
+  "image"
+  "io"
+  "strings"
+  "testing"
+  "time"
+
+  "github.com/BourgeoisBear/rasterm"
+)
+
+// stub_transmit stands in for the image, so tests see where it is written
+func stub_transmit(out io.Writer) error {
+  _, err := io.WriteString(out, "\x1b_Gimg\x1b\\")
+  return err
+}
+
+func TestKittyWritePlaceholder(t *testing.T) {
+  const cell = "\U0010EEEE"
+  // the row, column and high byte diacritics of the first cell of a row
+  first := func(row rune, high rune) string {
+    return cell + string(row) + "\u0305" + string(high)
+  }
+  tests := []struct {
+    name        string
+    id          uint32
+    cols, rows  int
+    offsetX     int
+    passthrough Passthrough
+    want        string
+  }{
+    {
+      "one cell", 1<<24 | 42, 1, 1, 0, NoPassthrough,
+      "\x1b_Gimg\x1b\\" + "\x1b[38;5;42m" + first('\u0305', '\u030D') + "\x1b[39m",
+    },
+    {
+      "rows are numbered", 2<<24 | 7, 3, 3, 0, NoPassthrough,
+      "\x1b_Gimg\x1b\\" +
+        "\x1b[38;5;7m" + first('\u0305', '\u030E') + cell + cell + "\x1b[39m\n" +
+        "\x1b[38;5;7m" + first('\u030D', '\u030E') + cell + cell + "\x1b[39m\n" +
+        "\x1b[38;5;7m" + first('\u030E', '\u030E') + cell + cell + "\x1b[39m",
+    },
+    {
+      "offset every row", 1<<24 | 255, 2, 2, 4, NoPassthrough,
+      "\x1b_Gimg\x1b\\" +
+        "\x1b[4C\x1b[38;5;255m" + first('\u0305', '\u030D') + cell + "\x1b[39m\n" +
+        "\x1b[4C\x1b[38;5;255m" + first('\u030D', '\u030D') + cell + "\x1b[39m",
+    },
+    {
+      // ids that don't fit the 256 colors are spelled out in true color
+      "true color id", 3<<24 | 0x123456, 1, 1, 0, NoPassthrough,
+      "\x1b_Gimg\x1b\\" + "\x1b[38;2;18;52;86m" + first('\u0305', '\u0310') + "\x1b[39m",
+    },
+    {
+      "only the image is passed through", 1<<24 | 42, 1, 1, 0, Tmux,
+      "\x1bPtmux;\x1b\x1b_Gimg\x1b\x1b\\\x1b\\" + "\x1b[38;5;42m" + first('\u0305', '\u030D') + "\x1b[39m",
+    },
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      out := new(bytes.Buffer)
+      if err := kitty_write_placeholder(out, tt.passthrough, stub_transmit, tt.id, tt.cols, tt.rows, tt.offsetX); err != nil {
+        t.Fatal(err)
+      }
+      if out.String() != tt.want {
+        t.Errorf("got %q, want %q", out.String(), tt.want)
+      }
+    })
+  }
+}
+
+func TestKittyWritePlaceholderClips(t *testing.T) {
+  // rows and columns past the last diacritic can't be numbered
+  out := new(bytes.Buffer)
+  if err := kitty_write_placeholder(out, NoPassthrough, stub_transmit, 1<<24|1, 1000, 1000, 0); err != nil {
+    t.Fatal(err)
+  }
+  n := len(placeholder_diacritics)
+  if got := strings.Count(out.String(), "\n") + 1; got != n {
+    t.Errorf("%d rows, want %d", got, n)
+  }
+  if got := strings.Count(out.String(), "\U0010EEEE"); got != n*n {
+    t.Errorf("%d cells, want %d", got, n*n)
+  }
+}
+
+func TestNewPlaceholderId(t *testing.T) {
+  for i := 0; i < 1000; i++ {
+    id := new_placeholder_id()
+    // the low byte is a 256 color foreground and the high byte a diacritic, nothing in between
+    if id&0xff == 0 || id&0xffff00 != 0 || id>>24 == 0 || int(id>>24) >= len(placeholder_diacritics) {
+      t.Fatalf("id %#x can't be drawn with a 256 color placeholder", id)
+    }
+  }
+}
+
+func TestKittyAnimationPlaceholder(t *testing.T) {
+  anim := &Animation{
+    Frames: []image.Image{test_image(4, 4), test_image(4, 4)},
+    Delays: []time.Duration{defaultFrameDelay, defaultFrameDelay},
+  }
+  out := new(bytes.Buffer)
+  if err := kitty_write_animation(out, anim, LoopGif, rasterm.KittyImgOpts{ImageId: 5}, true); err != nil {
+    t.Fatal(err)
+  }
+  // only the root frame places the image
+  for i, cmd := range kitty_commands(out.String()) {
+    if want := map[bool]string{true: "1", false: ""}[i == 0]; cmd["U"] != want {
+      t.Errorf("command %d %v has U=%s, want U=%s", i, cmd, cmd["U"], want)
+    }
+  }
+}
+
+func TestRenderPlaceholder(t *testing.T) {
+  path := test_file(t, "img.png", test_png(t, 64, 48))
+  opts := test_options(Kitty)
+  opts.Placeholder = true
+  out := new(bytes.Buffer)
+  if err := Render(context.Background(), out, path, opts); err != nil {
+    t.Fatal(err)
+  }
+  cmds := kitty_commands(out.String())
+  if len(cmds) == 0 || cmds[0]["a"] != "T" || cmds[0]["U"] != "1" {
+    t.Fatalf("image wasn't transmitted as a virtual placement: %v", cmds)
+  }
+  // 64x48 px on 10x15 px cells
+  if cmds[0]["c"] != "7" || cmds[0]["r"] != "4" {
+    t.Errorf("placement is %sx%s cells, want 7x4", cmds[0]["c"], cmds[0]["r"])
+  }
+  if got := strings.Count(out.String(), "\U0010EEEE"); got != 7*4 {
+    t.Errorf("%d placeholder cells, want %d", got, 7*4)
+  }
+}
@@ -0,0 +1,159 @@
+package render
+
+import (
+  "image"
+  "image/color"
+  "sort"
+)
+
+// sixel can't address more registers than a paletted image can index
+const maxPaletteSize = 256
+
+// colors are bucketed with 5 bits per channel before cutting
+const quantBits = 5
+
+type colorBin struct {
+  r, g, b uint8 // bucket coordinates
+  count   int
+  sumR    int
+  sumG    int
+  sumB    int
+}
+
+// a box of bins in the median cut
+type colorBox struct {
+  bins  []*colorBin
+  count int
+}
+
+func (box *colorBox) channel(bin *colorBin, ch int) uint8 {
+  switch ch {
+  case 0:
+    return bin.r
+  case 1:
+    return bin.g
+  }
+  return bin.b
+}
+
+// widest returns the channel with the largest range and that range
+func (box *colorBox) widest() (int, int) {
+  bestCh, bestRange := 0, -1
+  for ch := 0; ch < 3; ch++ {
+    lo, hi := uint8(255), uint8(0)
+    for _, bin := range box.bins {
+      v := box.channel(bin, ch)
+      lo = min(lo, v)
+      hi = max(hi, v)
+    }
+    if int(hi)-int(lo) > bestRange {
+      bestCh, bestRange = ch, int(hi)-int(lo)
+    }
+  }
+  return bestCh, bestRange
+}
+
+// split cuts the box at the weighted median of its widest channel
+func (box *colorBox) split() (*colorBox, *colorBox) {
+  ch, _ := box.widest()
+  sort.SliceStable(box.bins, func(i, j int) bool {
+    return box.channel(box.bins[i], ch) < box.channel(box.bins[j], ch)
+  })
+
+  half, acc, cut := box.count/2, 0, 1
+  for i, bin := range box.bins[:len(box.bins)-1] {
+    acc += bin.count
+    cut = i + 1
+    if acc >= half {
+      break
+    }
+  }
+
+  a := &colorBox{bins: box.bins[:cut]}
+  b := &colorBox{bins: box.bins[cut:]}
+  for _, bin := range a.bins {
+    a.count += bin.count
+  }
+  b.count = box.count - a.count
+  return a, b
+}
+
+func (box *colorBox) average() color.Color {
+  var r, g, b, n int
+  for _, bin := range box.bins {
+    r, g, b, n = r+bin.sumR, g+bin.sumG, b+bin.sumB, n+bin.count
+  }
+  return color.RGBA{uint8(r / n), uint8(g / n), uint8(b / n), 0xff}
+}
+
+// median_cut builds a palette of at most n colors fitted to the colors of img,
+// transparent pixels are ignored
+func median_cut(img image.Image, n int) color.Palette {
+  if n <= 0 || n > maxPaletteSize {
+    n = maxPaletteSize
+  }
+
+  const shift = 8 - quantBits
+  bins := map[uint16]*colorBin{}
+  bounds := img.Bounds()
+  total := 0
+  for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+    for x := bounds.Min.X; x < bounds.Max.X; x++ {
+      c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+      if c.A < 0x80 {
+        continue
+      }
+      key := uint16(c.R>>shift)<<(2*quantBits) | uint16(c.G>>shift)<<quantBits | uint16(c.B>>shift)
+      bin, exists := bins[key]
+      if !exists {
+        bin = &colorBin{r: c.R >> shift, g: c.G >> shift, b: c.B >> shift}
+        bins[key] = bin
+      }
+      bin.count++
+      bin.sumR += int(c.R)
+      bin.sumG += int(c.G)
+      bin.sumB += int(c.B)
+      total++
+    }
+  }
+  if total == 0 {
+    return color.Palette{color.Black}
+  }
+
+  // map order is random, sort so the same image always gets the same palette
+  keys := make([]int, 0, len(bins))
+  for key := range bins {
+    keys = append(keys, int(key))
+  }
+  sort.Ints(keys)
+  root := &colorBox{count: total}
+  for _, key := range keys {
+    root.bins = append(root.bins, bins[uint16(key)])
+  }
+  boxes := []*colorBox{root}
+  for len(boxes) < n {
+    // split the box that covers the most pixels over the widest range
+    best, bestScore := -1, 0
+    for i, box := range boxes {
+      if len(box.bins) < 2 {
+        continue
+      }
+      _, spread := box.widest()
+      if score := spread * box.count; score > bestScore {
+        best, bestScore = i, score
+      }
+    }
+    if best < 0 {
+      break
+    }
+    a, b := boxes[best].split()
+    boxes[best] = a
+    boxes = append(boxes, b)
+  }
+
+  palette := make(color.Palette, 0, len(boxes))
+  for _, box := range boxes {
+    palette = append(palette, box.average())
+  }
+  return palette
+}
@@ -0,0 +1,97 @@
+package render
+
+import (
+  "image"
+  "image/color"
+  "reflect"
+  "testing"
+)
+
+// stripes paints img with one vertical stripe per color
+func stripes(colors ...color.Color) image.Image {
+  img := image.NewNRGBA(image.Rect(0, 0, 4*len(colors), 4))
+  for x := 0; x < img.Bounds().Dx(); x++ {
+    for y := 0; y < 4; y++ {
+      img.Set(x, y, colors[x/4])
+    }
+  }
+  return img
+}
+
+func TestMedianCut(t *testing.T) {
+  red := color.RGBA{0xff, 0, 0, 0xff}
+  green := color.RGBA{0, 0xff, 0, 0xff}
+  blue := color.RGBA{0, 0, 0xff, 0xff}
+  hidden := color.NRGBA{0, 0, 0xff, 0}
+
+  tests := []struct {
+    name string
+    img  image.Image
+    n    int
+    want color.Palette
+    // wantLen is checked instead of want when the exact colors don't matter
+    wantLen int
+  }{
+    {"fewer colors than n", stripes(red, green, blue), 8, color.Palette{red, green, blue}, 0},
+    {"transparent pixels are ignored", stripes(red, hidden), 8, color.Palette{red}, 0},
+    {"fully transparent", stripes(hidden), 8, color.Palette{color.Black}, 0},
+    {"cut down to n", test_image(64, 48), 16, nil, 16},
+    {"n of 0 allows the most", test_image(64, 48), 0, nil, maxPaletteSize},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      got := median_cut(tt.img, tt.n)
+      if tt.want != nil {
+        if len(got) != len(tt.want) {
+          t.Fatalf("palette %v, want %v", got, tt.want)
+        }
+        for _, c := range tt.want {
+          if got.Convert(c) != c {
+            t.Errorf("palette %v is missing %v", got, c)
+          }
+        }
+        return
+      }
+      if len(got) != tt.wantLen {
+        t.Errorf("palette has %d colors, want %d", len(got), tt.wantLen)
+      }
+      // the same image always gets the same palette, so animations don't flicker
+      if again := median_cut(tt.img, tt.n); !reflect.DeepEqual(got, again) {
+        t.Error("palette changed between runs")
+      }
+    })
+  }
+}
+
+func TestSixelColors(t *testing.T) {
+  tests := []struct {
+    colors int
+    want   int
+  }{
+    {16, 16},
+    {256, 256},
+    {1024, maxPaletteSize},
+  }
+  for _, tt := range tests {
+    if got := sixel_colors(tt.colors, NoPassthrough, DefaultQueryTimeout); got != tt.want {
+      t.Errorf("sixel_colors(%d) = %d, want %d", tt.colors, got, tt.want)
+    }
+  }
+}
+
+func TestConvertToPaletted(t *testing.T) {
+  red := color.RGBA{0xff, 0, 0, 0xff}
+  green := color.RGBA{0, 0xff, 0, 0xff}
+  // few flat colors come out exactly
+  img := stripes(red, green)
+  paletted := convertToPaletted(img, 16, FloydSteinberg)
+  for _, x := range []int{0, 7} {
+    if got, want := paletted.At(x, 0), img.At(x, 0); color.RGBAModel.Convert(got) != color.RGBAModel.Convert(want) {
+      t.Errorf("pixel %d is %v, want %v", x, got, want)
+    }
+  }
+
+  if got := len(convertToPaletted(test_image(64, 48), 16, FloydSteinberg).Palette); got > 16 {
+    t.Errorf("palette has %d colors, want at most 16", got)
+  }
+}
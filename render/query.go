@@ -0,0 +1,168 @@
+package render
+
+import (
+  "fmt"
+  "strings"
+  "time"
+)
+
+// DefaultQueryTimeout is how long the terminal gets to answer a batch of queries
+const DefaultQueryTimeout = 200 * time.Millisecond
+
+// the DA1 query, every terminal answers it and answers in order,
+// so its reply coming back means every query before it was answered or ignored
+const sentinel = "\x1b[c"
+
+// reply is a control sequence the terminal answered with
+type reply struct {
+  // kind is the byte after ESC: '[' for CSI, ']' for OSC, 'P' for DCS and '_' for APC
+  kind byte
+  // data is everything between the introducer and the terminator, a CSI keeps its final byte
+  data string
+}
+
+// is_da1 reports if r is the answer to the sentinel, like \x1b[?62;4;22c
+func (r reply) is_da1() bool {
+  return r.kind == '[' && strings.HasPrefix(r.data, "?") && strings.HasSuffix(r.data, "c")
+}
+
+// query_terminal sends the queries followed by the sentinel and returns the replies read up to the sentinel's,
+// which is always the last one. passthrough wraps all of them, so they reach the same terminal.
+// the terminal gets timeout to answer, DefaultQueryTimeout when it isn't positive.
+// on a timeout the replies read so far are returned along with the error
+func query_terminal(passthrough Passthrough, timeout time.Duration, queries ...string) ([]reply, error) {
+  if timeout <= 0 {
+    timeout = DefaultQueryTimeout
+  }
+  in, out, closeTty, err := open_tty()
+  if err != nil {
+    return nil, err
+  }
+  defer closeTty()
+  restore := make_raw(int(in.Fd()))
+  defer restore()
+
+  batch := []byte{}
+  for _, query := range append(queries, sentinel) {
+    batch = append(batch, passthrough.wrap([]byte(query))...)
+  }
+  if _, err := out.Write(batch); err != nil {
+    return nil, err
+  }
+
+  deadline := time.Now().Add(timeout)
+  parser := replyParser{}
+  buf := make([]byte, 4096)
+  for {
+    n, err := read_tty(in, buf, deadline)
+    if err != nil {
+      return parser.replies, fmt.Errorf("terminal didn't answer %q within %v: %v", queries, timeout, err)
+    }
+    parser.feed(buf[:n])
+    if len(parser.replies) > 0 && parser.replies[len(parser.replies)-1].is_da1() {
+      return parser.replies, nil
+    }
+  }
+}
+
+// find_csi returns the parameters of the first CSI reply that starts with prefix and ends with final
+func find_csi(replies []reply, prefix string, final byte) ([]string, bool) {
+  for _, r := range replies {
+    if r.kind == '[' && strings.HasPrefix(r.data, prefix) && r.data[len(r.data)-1] == final {
+      return strings.Split(r.data[:len(r.data)-1], ";"), true
+    }
+  }
+  return nil, false
+}
+
+// find_string returns the first OSC, DCS or APC reply of kind that starts with prefix
+func find_string(replies []reply, kind byte, prefix string) (string, bool) {
+  for _, r := range replies {
+    if r.kind == kind && strings.HasPrefix(r.data, prefix) {
+      return r.data, true
+    }
+  }
+  return "", false
+}
+
+const (
+  parseGround = iota
+  parseEscape
+  parseCSI
+  // the body of an OSC, DCS or APC, which runs until ST
+  parseString
+  // an ESC inside a string, ST when a backslash follows
+  parseStringEscape
+)
+
+// replyParser splits what the terminal sends into replies, anything else, like keys typed
+// while waiting, is dropped
+type replyParser struct {
+  state   int
+  kind    byte
+  data    []byte
+  replies []reply
+}
+
+func (p *replyParser) feed(data []byte) {
+  for _, b := range data {
+    p.step(b)
+  }
+}
+
+func (p *replyParser) step(b byte) {
+  switch p.state {
+  case parseGround:
+    if b == 0x1b {
+      p.state = parseEscape
+    }
+  case parseEscape:
+    switch b {
+    case '[', ']', 'P', '_':
+      p.kind, p.data = b, p.data[:0]
+      p.state = parseString
+      if b == '[' {
+        p.state = parseCSI
+      }
+    case 0x1b:
+    default:
+      // alt + key, or a sequence we don't expect a reply in
+      p.state = parseGround
+    }
+  case parseCSI:
+    switch {
+    case b >= 0x40 && b <= 0x7e:
+      p.data = append(p.data, b)
+      p.emit()
+    case b >= 0x20 && b < 0x40:
+      p.data = append(p.data, b)
+    case b == 0x1b:
+      p.state = parseEscape
+    default:
+      p.state = parseGround
+    }
+  case parseString:
+    switch {
+    case b == 0x1b:
+      p.state = parseStringEscape
+    case b == 0x07 && p.kind == ']':
+      // xterm ends OSC replies with BEL when the query did
+      p.emit()
+    default:
+      p.data = append(p.data, b)
+    }
+  case parseStringEscape:
+    if b == '\\' {
+      p.emit()
+      return
+    }
+    // an unterminated string, b starts whatever comes next
+    p.state = parseEscape
+    p.step(b)
+  }
+}
+
+func (p *replyParser) emit() {
+  p.replies = append(p.replies, reply{kind: p.kind, data: string(p.data)})
+  p.state = parseGround
+}
@@ -0,0 +1,147 @@
+package render
+
+import (
+  "image/color"
+  "reflect"
+  "testing"
+)
+
+func TestReplyParser(t *testing.T) {
+  tests := []struct {
+    name string
+    // chunks are fed one after the other, like reads from the tty
+    chunks []string
+    want   []reply
+  }{
+    {"csi", []string{"\x1b[4;600;800t"}, []reply{{'[', "4;600;800t"}}},
+    {"da1", []string{"\x1b[?62;4;22c"}, []reply{{'[', "?62;4;22c"}}},
+    {"osc ended by st", []string{"\x1b]11;rgb:1e1e/2020/2929\x1b\\"}, []reply{{']', "11;rgb:1e1e/2020/2929"}}},
+    {"osc ended by bel", []string{"\x1b]10;rgb:ffff/ffff/ffff\x07"}, []reply{{']', "10;rgb:ffff/ffff/ffff"}}},
+    {"apc", []string{"\x1b_Gi=31;OK\x1b\\"}, []reply{{'_', "Gi=31;OK"}}},
+    {"dcs", []string{"\x1bP1$r0m\x1b\\"}, []reply{{'P', "1$r0m"}}},
+    {
+      "a batch",
+      []string{"\x1b[4;600;800t\x1b[8;30;100t\x1b[?62;4c"},
+      []reply{{'[', "4;600;800t"}, {'[', "8;30;100t"}, {'[', "?62;4c"}},
+    },
+    {
+      "split across reads",
+      []string{"\x1b", "]11;rgb:00", "/00/00\x1b", "\\\x1b[?6", "2c"},
+      []reply{{']', "11;rgb:00/00/00"}, {'[', "?62c"}},
+    },
+    {"typed keys are dropped", []string{"ls\r\x1b[8;30;100tq"}, []reply{{'[', "8;30;100t"}}},
+    {"alt and a key", []string{"\x1bx\x1b[?62c"}, []reply{{'[', "?62c"}}},
+    {"an unterminated string", []string{"\x1b]11;rgb\x1b[?62c"}, []reply{{'[', "?62c"}}},
+    {"bel only ends osc", []string{"\x1b_Ga\x07b\x1b\\"}, []reply{{'_', "Ga\x07b"}}},
+    {"nothing", []string{"hello"}, nil},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      parser := replyParser{}
+      for _, chunk := range tt.chunks {
+        parser.feed([]byte(chunk))
+      }
+      if !reflect.DeepEqual(parser.replies, tt.want) {
+        t.Errorf("got %q, want %q", parser.replies, tt.want)
+      }
+    })
+  }
+}
+
+func TestFindReplies(t *testing.T) {
+  replies := []reply{
+    {']', "11;rgb:1e1e/2020/2929"},
+    {'[', "4;600;800t"},
+    {'[', "8;30;100t"},
+    {'[', "?62;4;22c"},
+  }
+  if got, ok := find_csi(replies, "8;", 't'); !ok || !reflect.DeepEqual(got, []string{"8", "30", "100"}) {
+    t.Errorf("find_csi 8;...t = %q, %v", got, ok)
+  }
+  if _, ok := find_csi(replies, "6;", 't'); ok {
+    t.Error("find_csi found a reply that wasn't sent")
+  }
+  if _, ok := find_csi(replies, "4;", 'c'); ok {
+    t.Error("find_csi ignored the final byte")
+  }
+  if !replies[3].is_da1() || replies[1].is_da1() {
+    t.Error("is_da1 didn't tell the sentinel apart")
+  }
+  if got, ok := find_string(replies, ']', "11;"); !ok || got != "11;rgb:1e1e/2020/2929" {
+    t.Errorf("find_string 11; = %q, %v", got, ok)
+  }
+  if _, ok := find_string(replies, '_', "11;"); ok {
+    t.Error("find_string ignored the kind")
+  }
+}
+
+func TestSizeReplies(t *testing.T) {
+  batch := []reply{{'[', "4;600;800t"}, {'[', "8;30;100t"}, {'[', "?62;4c"}}
+  tests := []struct {
+    name    string
+    replies []reply
+    get     func([]reply) (int, int, error)
+    w, h    int
+    wantErr bool
+  }{
+    {"px", batch, get_size_osc, 800, 600, false},
+    {"cells", batch, func(r []reply) (int, int, error) {
+      var handler string
+      return get_size_cells(r, &handler)
+    }, 100, 30, false},
+    {"unanswered", batch[2:], get_size_osc, 0, 0, true},
+    {"zero", []reply{{'[', "4;0;0t"}}, get_size_osc, 0, 0, true},
+    {"garbled", []reply{{'[', "4;six;800t"}}, get_size_osc, 0, 0, true},
+    {"short", []reply{{'[', "4;600t"}}, get_size_osc, 0, 0, true},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      w, h, err := tt.get(tt.replies)
+      if tt.wantErr {
+        if err == nil {
+          t.Errorf("got %dx%d, want an error", w, h)
+        }
+        return
+      }
+      if err != nil || w != tt.w || h != tt.h {
+        t.Errorf("got %dx%d, %v, want %dx%d", w, h, err, tt.w, tt.h)
+      }
+    })
+  }
+}
+
+func TestOscColor(t *testing.T) {
+  replies := []reply{
+    {']', "10;rgb:ffff/ffff/ffff"},
+    {']', "11;rgb:1e1e/2020/2929"},
+    {']', "4;10;rgb:00/ff/00"},
+    {']', "4;1;rgb:cc/24/1d"},
+    {'[', "?62c"},
+  }
+  tests := []struct {
+    prefix  string
+    want    color.RGBA
+    wantErr bool
+  }{
+    {"10;", color.RGBA{0xff, 0xff, 0xff, 0xff}, false},
+    {"11;", color.RGBA{0x1e, 0x20, 0x29, 0xff}, false},
+    // ansi 1 isn't confused with ansi 10
+    {"4;1;", color.RGBA{0xcc, 0x24, 0x1d, 0xff}, false},
+    {"4;10;", color.RGBA{0x00, 0xff, 0x00, 0xff}, false},
+    {"4;2;", color.RGBA{}, true},
+  }
+  for _, tt := range tests {
+    t.Run(tt.prefix, func(t *testing.T) {
+      got, err := osc_color(replies, tt.prefix)
+      if tt.wantErr {
+        if err == nil {
+          t.Errorf("got %v, want an error", got)
+        }
+        return
+      }
+      if err != nil || got != tt.want {
+        t.Errorf("got %v, %v, want %v", got, err, tt.want)
+      }
+    })
+  }
+}
@@ -0,0 +1,527 @@
+package render
+
+import (
+  "bufio"
+  "context"
+  "fmt"
+  "image"
+  "image/color"
+  _ "image/jpeg"
+  _ "image/png"
+  "io"
+  "os"
+  "strings"
+  "time"
+
+  "github.com/BourgeoisBear/rasterm"
+  "golang.org/x/term"
+)
+
+type Protocol string
+
+const (
+  Auto  Protocol = "auto"
+  Kitty Protocol = "kitty"
+  Iterm Protocol = "iterm"
+  Sixel Protocol = "sixel"
+  // Blocks draws with unicode half blocks, works in any terminal with colors
+  Blocks Protocol = "blocks"
+  // Braille draws with 2x4 braille dots per cell
+  Braille Protocol = "braille"
+  // Ascii draws with characters picked by luminance
+  Ascii Protocol = "ascii"
+)
+
+// ParseProtocol maps a user supplied protocol name to a Protocol
+func ParseProtocol(protocol string) (Protocol, error) {
+  switch p := Protocol(strings.ToLower(protocol)); p {
+  case Auto, Kitty, Iterm, Sixel, Blocks, Braille, Ascii:
+    return p, nil
+  }
+  return "", fmt.Errorf("invalid protocol '%s'. Must be kitty, iterm, sixel, blocks, braille or ascii", protocol)
+}
+
+// isText reports if the protocol draws with characters rather than a graphics protocol
+func (p Protocol) isText() bool {
+  return p == Blocks || p == Braille || p == Ascii
+}
+
+// Options controls how Render sizes, places and encodes an image
+type Options struct {
+  // Width and Height of the image, 0 keeps the aspect ratio for that side
+  Width  Dimension
+  Height Dimension
+  // ResizeMode used to fit the image into Width x Height, Fit when empty
+  ResizeMode ResizeMethod
+  // Protocol to encode with, Auto detects it from the terminal
+  Protocol Protocol
+  // Fallback is used when Protocol is Auto and nothing was detected
+  Fallback Protocol
+  // Center horizontally aligns the image to the screen, ignored when Align is set
+  Center bool
+  // Align places the image on the screen, or on the part of it Scale leaves,
+  // AlignInline draws it at the cursor
+  Align Align
+  // Place fits the image into a rectangle of cells instead of Width x Height and draws it there,
+  // the cursor is left where it was. the image sits at the top left unless Align is set
+  Place Place
+  // Cache the heavy operations, like converting documents
+  Cache bool
+  // CacheMax is the size in bytes the cache is trimmed to when writing to it, 0 means unlimited
+  CacheMax int64
+  // ScreenPx and ScreenCell are the <width>x<height>[xForce] fallbacks / overwrites
+  // for the size of the window in px and in cells, the ones of DefaultOptions when empty
+  ScreenPx   string
+  ScreenCell string
+  // Scale is <float>x<float>, scales the screen size. 1x1 when empty
+  Scale string
+  // AutoRotate turns jpeg and tiff photos upright using their exif orientation
+  AutoRotate bool
+  // Region is the part of the image to render, the zero Region renders all of it
+  Region Region
+  // Rotate turns the image clockwise by degrees after Region is cut out,
+  // angles that aren't quarter turns leave the corners transparent
+  Rotate float64
+  // Flip mirrors the image after it is turned
+  Flip Flip
+  // Adjust changes the colors of the resized image before it is encoded, step by step in order
+  Adjust []Adjustment
+  // AutoInvert inverts images with a mostly white background when the terminal background is dark
+  AutoInvert bool
+  // Background is what transparent pixels are drawn over, BackgroundTransparent keeps them transparent
+  Background Background
+  // Pages of documents to render, the zero value renders the first page
+  Pages PageRange
+  // PageLayout arranges the pages of a range
+  PageLayout PageLayout
+  // Converters is the order document converters are tried in, empty uses ConverterNames
+  Converters []string
+  // Colors is the size of the sixel palette, 0 asks the terminal how many registers it has.
+  // at most 256 colors are used
+  Colors int
+  // TextColor colors the braille and ascii output, blocks are always colored
+  TextColor bool
+  // Dither used for every paletted output, sixel, braille dots and 256 / 16 color text
+  Dither Dither
+  // Loop is how many times to play animations, LoopGif uses the gif's own count
+  // and LoopForever never stops
+  Loop int
+  // Passthrough wraps graphics for tmux or screen, PassthroughAuto detects the multiplexer
+  Passthrough Passthrough
+  // QueryTimeout is how long the terminal gets to answer a batch of queries, like its size and colors.
+  // terminals answer right away, so it only matters over slow connections and for ones that don't answer at all
+  QueryTimeout time.Duration
+  // Placeholder places kitty images with unicode placeholder cells, so multiplexers and
+  // editors move and clip them like text
+  Placeholder bool
+  // ImageID and PlacementID name the kitty image so it can be cleared or replaced later,
+  // 0 leaves the image unnamed
+  ImageID     uint32
+  PlacementID uint32
+  // Report is called with what was drawn once the image is on the screen,
+  // kitty images get an id when ImageID is 0 so they can be cleared later
+  Report func(Report)
+}
+
+// Report describes what Render drew, for callers that move the cursor around or clear the image
+type Report struct {
+  Protocol Protocol `json:"protocol"`
+  // Width and Height of the encoded image in px
+  Width  int `json:"width"`
+  Height int `json:"height"`
+  // Cols and Rows the image covers
+  Cols int `json:"cols"`
+  Rows int `json:"rows"`
+  // X and Y of the top left cell of the image, counted from 0 from the top left of the screen
+  // when Absolute, otherwise from where the cursor was
+  X        int  `json:"x"`
+  Y        int  `json:"y"`
+  Absolute bool `json:"absolute"`
+  // ImageID and PlacementID of kitty images, 0 for the other protocols
+  ImageID     uint32 `json:"image_id"`
+  PlacementID uint32 `json:"placement_id"`
+}
+
+// DefaultOptions returns the options the cli uses when no flags are given
+func DefaultOptions() Options {
+  return Options{
+    Width:        Dimension{value: 80, kind: Percent},
+    Height:       Dimension{value: 60, kind: Percent},
+    ResizeMode:   Fit,
+    Protocol:     Auto,
+    Fallback:     Sixel,
+    Center:       true,
+    Cache:        true,
+    CacheMax:     DefaultCacheMax,
+    ScreenPx:     "1920x1080",
+    ScreenCell:   "120x30",
+    Scale:        "1x1",
+    AutoRotate:   true,
+    Pages:        PageRange{First: 1, Last: 1},
+    PageLayout:   Stack,
+    Dither:       FloydSteinberg,
+    Loop:         LoopGif,
+    Passthrough:  PassthroughAuto,
+    QueryTimeout: DefaultQueryTimeout,
+  }
+}
+
+// is_terminal reports if w writes to a terminal rather than a file, a pipe or memory
+func is_terminal(w io.Writer) bool {
+  f, ok := w.(*os.File)
+  return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// Render decodes the image or document at source, resizes it according to opts
+// and writes it to w using the chosen terminal graphics protocol.
+// a source of "-" reads the image from stdin
+func Render(ctx context.Context, w io.Writer, source string, opts Options) error {
+  if source == "-" {
+    return RenderReader(ctx, w, os.Stdin, opts)
+  }
+  return render(ctx, w, file_input(source), opts)
+}
+
+// RenderReader is Render for an image or document held in r,
+// the format is sniffed from the leading bytes
+func RenderReader(ctx context.Context, w io.Writer, r io.Reader, opts Options) error {
+  data, err := io.ReadAll(r)
+  if err != nil {
+    return fmt.Errorf("Error reading image: %v", err)
+  }
+  if len(data) == 0 {
+    return fmt.Errorf("Error reading image: no data")
+  }
+  return render(ctx, w, data_input(data), opts)
+}
+
+func render(ctx context.Context, w io.Writer, in input, opts Options) error {
+  width, height := opts.Width, opts.Height
+  placed := opts.Place.set()
+  if placed {
+    width, height = NewDimension(opts.Place.Cols, Cell), NewDimension(opts.Place.Rows, Cell)
+  }
+  width.direction = X
+  height.direction = Y
+
+  protocol, err := resolve_protocol(opts)
+  if err != nil {
+    return err
+  }
+
+  sSize := ScreenSize{}
+  sSize.query(opts.ScreenPx, opts.ScreenCell, opts.Scale, opts.Passthrough.resolve(), opts.QueryTimeout)
+
+  t := transform{region: opts.Region, degrees: opts.Rotate, flip: opts.Flip}
+  // text is written line after line and can't be redrawn in place, so it draws the first frame only.
+  // so does sixel and iterm output that isn't going to a terminal, a file would never stop growing.
+  // kitty sends the frames once and lets the terminal play them
+  var anim *Animation
+  if !protocol.isText() && (protocol == Kitty || is_terminal(w)) {
+    anim, err = get_animation(ctx, in, width, height, opts.ResizeMode, t, sSize)
+    if err != nil {
+      return err
+    }
+  }
+
+  var resizedImg image.Image
+  if anim != nil {
+    resizedImg = anim.Frames[0]
+  } else {
+    resizedImg, err = get_img(ctx, in, width, height, opts.ResizeMode, opts.Pages, opts.PageLayout, opts.Converters, opts.Cache, opts.CacheMax, opts.AutoRotate, t, sSize)
+    if err != nil {
+      return err
+    }
+  }
+  if err := ctx.Err(); err != nil {
+    return err
+  }
+
+  adjustments := opts.Adjust
+  // decided on the first frame, so every frame of an animation is treated the same
+  if opts.AutoInvert && white_background(resizedImg) && dark_background(opts.QueryTimeout) {
+    adjustments = append([]Adjustment{{Kind: Invert}}, adjustments...)
+  }
+  // flattened after adjusting, so the backdrop keeps its own colors
+  backdrop := opts.Background.backdrop(opts.QueryTimeout)
+  if len(adjustments) > 0 || backdrop != nil {
+    finish := func(img image.Image) image.Image {
+      img = adjust_image(img, adjustments)
+      if backdrop != nil {
+        img = flatten(img, backdrop)
+      }
+      return img
+    }
+    if anim != nil {
+      for i, frame := range anim.Frames {
+        anim.Frames[i] = finish(frame)
+      }
+      resizedImg = anim.Frames[0]
+    } else {
+      resizedImg = finish(resizedImg)
+    }
+  }
+
+  writer := bufio.NewWriterSize(w, 64*1024) // 64 KB buffer
+  passthrough := opts.Passthrough.resolve()
+  // kitty placeholders are written as text, only the image behind them is passed through
+  placeholder := protocol == Kitty && opts.Placeholder
+  textual := protocol.isText() || placeholder
+  if textual {
+    // text is plain output the multiplexer draws itself
+    passthrough = NoPassthrough
+  }
+  rows := image_rows(resizedImg, sSize)
+  positioned := opts.Align != AlignInline || placed
+
+  // frames are redrawn in place, so the image can't be allowed to scroll the screen.
+  // the multiplexer doesn't see passed through images either, so make room for it up front.
+  // an aligned image is placed to fit, so it doesn't scroll
+  if !positioned && ((anim != nil && protocol != Kitty) || passthrough != NoPassthrough) {
+    reserve_rows(writer, rows)
+  }
+
+  var offsetX, offsetY int
+  // moves the cursor back to where the image starts, for redrawing frames
+  var home string
+  if placed {
+    align := opts.Align
+    if align == AlignInline {
+      align = "top-left"
+    }
+    offsetX, offsetY = AlignImage(resizedImg, opts.Place.area(sSize), align)
+    offsetX, offsetY = offsetX+opts.Place.X, offsetY+opts.Place.Y
+    writer.WriteString("\x1b7")
+    home = fmt.Sprintf("\r\x1b[%dd", offsetY+1)
+  } else if positioned {
+    offsetX, offsetY = AlignImage(resizedImg, sSize, opts.Align)
+    // the last row is left for the newline after the image, so the screen doesn't scroll
+    offsetY = max(min(offsetY, sSize.heightCell-rows-1), 0)
+    home = fmt.Sprintf("\r\x1b[%dd", offsetY+1)
+  } else if opts.Center {
+    offsetX, _ = CenterImage(resizedImg, sSize)
+  }
+  writer.WriteString(home)
+  // text is drawn line by line, so it moves every line itself
+  if offsetX > 0 && !textual {
+    center_esc := fmt.Sprintf("\x1b[%dC", offsetX)
+    writer.WriteString(center_esc)
+    if home != "" {
+      home += center_esc
+    }
+  }
+
+  imageID := opts.ImageID
+  if protocol == Kitty && imageID == 0 {
+    switch {
+    case placeholder:
+      imageID = new_placeholder_id()
+    case opts.Report != nil:
+      // named so the caller can clear it
+      imageID = new_image_id()
+    }
+  }
+
+  var encode func(io.Writer, image.Image) error
+  var format string
+  switch protocol {
+  case Iterm:
+    encode, format = rasterm.ItermWriteImage, "iTerm"
+  case Kitty:
+    kittyOpts := rasterm.KittyImgOpts{ImageId: imageID, PlacementId: opts.PlacementID}
+    encode, format = func(out io.Writer, frame image.Image) error {
+      return kitty_write_image(out, frame, kittyOpts)
+    }, "Kitty"
+    if anim != nil {
+      encode = func(out io.Writer, _ image.Image) error {
+        return kitty_write_animation(out, anim, opts.Loop, kittyOpts, false)
+      }
+    }
+    if placeholder {
+      cols, lines := text_grid(resizedImg, sSize)
+      kittyOpts = rasterm.KittyImgOpts{ImageId: imageID, DstCols: uint32(cols), DstRows: uint32(lines)}
+      encode = func(out io.Writer, frame image.Image) error {
+        transmit := func(out io.Writer) error {
+          if anim != nil {
+            return kitty_write_animation(out, anim, opts.Loop, kittyOpts, true)
+          }
+          return kitty_write_chunked(out, kittyOpts.ToHeader("a=T", "U=1", "f=100", "q=2"), frame)
+        }
+        return kitty_write_placeholder(out, opts.Passthrough.resolve(), transmit, kittyOpts.ImageId, cols, lines, offsetX)
+      }
+    }
+  case Sixel:
+    colors := sixel_colors(opts.Colors, passthrough, opts.QueryTimeout)
+    encode, format = func(out io.Writer, frame image.Image) error {
+      return rasterm.SixelWriteImage(out, convertToPaletted(frame, colors, opts.Dither))
+    }, "Sixel"
+  case Blocks, Braille, Ascii:
+    st := textStyle{offsetX: offsetX, positioned: positioned, depth: detect_color_depth(), color: opts.TextColor, dither: opts.Dither}
+    // the terminal is only asked for what the output uses
+    if st.depth != TrueColor && (protocol == Blocks || st.color) {
+      st.palette = st.depth.palette(terminal_colors(opts.QueryTimeout).ansi)
+    }
+    if protocol != Blocks {
+      st.light = light_background(opts.QueryTimeout)
+    }
+    write := map[Protocol]func(io.Writer, image.Image, ScreenSize, textStyle) error{
+      Blocks:  write_blocks,
+      Braille: write_braille,
+      Ascii:   write_ascii,
+    }[protocol]
+    encode = func(out io.Writer, frame image.Image) error {
+      return write(out, frame, sSize, st)
+    }
+  default:
+    return fmt.Errorf("invalid protocol '%s'. Must be kitty, iterm, sixel, blocks, braille or ascii", protocol)
+  }
+  encode = passthrough.wrapEncoder(encode)
+
+  if anim != nil && protocol != Kitty {
+    err = play_frames(ctx, writer, anim, opts.Loop, home, encode)
+  } else {
+    err = encode(writer, resizedImg)
+  }
+  if err != nil {
+    if protocol.isText() {
+      return fmt.Errorf("Error drawing %s: %v", protocol, err)
+    }
+    return fmt.Errorf("Error encoding to %s format: %v", format, err)
+  }
+
+  if placed {
+    // back to where the caller left the cursor
+    writer.WriteString("\x1b8")
+  } else {
+    // the multiplexer's cursor stayed where the image started, move it to its last row
+    if passthrough != NoPassthrough && rows > 1 {
+      fmt.Fprintf(writer, "\x1b[%dB", rows-1)
+    }
+    writer.WriteString("\n")
+  }
+  if err := writer.Flush(); err != nil {
+    return err
+  }
+
+  if opts.Report != nil {
+    report := Report{
+      Protocol: protocol,
+      Width:    resizedImg.Bounds().Dx(),
+      Height:   resizedImg.Bounds().Dy(),
+      X:        offsetX,
+      Y:        offsetY,
+      Absolute: positioned,
+    }
+    report.Cols, report.Rows = text_grid(resizedImg, sSize)
+    if protocol == Kitty {
+      report.ImageID, report.PlacementID = imageID, opts.PlacementID
+    }
+    opts.Report(report)
+  }
+  return nil
+}
+
+// resolve_protocol returns the protocol of opts, detecting it when it is Auto
+func resolve_protocol(opts Options) (Protocol, error) {
+  protocol := opts.Protocol
+  if protocol == "" {
+    protocol = Auto
+  }
+  if protocol == Auto {
+    useIterm, useKitty, useSixel := DetectCap(opts.Fallback, opts.Passthrough, opts.QueryTimeout)
+    switch {
+    case useIterm:
+      protocol = Iterm
+    case useKitty:
+      protocol = Kitty
+    case useSixel:
+      protocol = Sixel
+    case opts.Fallback.isText():
+      protocol = opts.Fallback
+    default:
+      return "", fmt.Errorf("No capable terminal detected (Kitty, iTerm, or Sixel), and no protocol forced.")
+    }
+  }
+  return protocol, nil
+}
+
+// image_rows returns how many rows img covers on the screen, 0 when the cell size is unknown
+func image_rows(img image.Image, sSize ScreenSize) int {
+  if sSize.heightCell <= 0 {
+    return 0
+  }
+  cellHeight := sSize.heightPx / sSize.heightCell
+  if cellHeight <= 0 {
+    return 0
+  }
+  return (img.Bounds().Dy() + cellHeight - 1) / cellHeight
+}
+
+// sixel_colors returns how many colors to quantize sixel output to,
+// asking the terminal when colors isn't set
+func sixel_colors(colors int, passthrough Passthrough, timeout time.Duration) int {
+  if colors <= 0 {
+    registers, err := get_sixel_registers(passthrough, timeout)
+    if err != nil {
+      logger.Write(fmt.Sprintf("sixel registers: %v", err))
+      return maxPaletteSize
+    }
+    colors = registers
+  }
+  return min(colors, maxPaletteSize)
+}
+
+// convertToPaletted quantizes img to colors for sixel, pixels more transparent than opaque
+// get a transparent palette entry of their own, which sixel leaves undrawn
+func convertToPaletted(img image.Image, colors int, dither Dither) *image.Paletted {
+  if !has_transparency(img) {
+    return dither.quantize(img, median_cut(img, colors))
+  }
+  paletted := dither.quantize(img, median_cut(img, max(colors-1, 1)))
+  // added after dithering, so no opaque pixel is matched to it
+  transparent := uint8(len(paletted.Palette))
+  paletted.Palette = append(paletted.Palette, color.NRGBA{})
+  bounds := img.Bounds()
+  for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+    for x := bounds.Min.X; x < bounds.Max.X; x++ {
+      if !is_opaque(img.At(x, y)) {
+        paletted.SetColorIndex(x, y, transparent)
+      }
+    }
+  }
+  return paletted
+}
+
+// DetectCap reports which protocols the terminal supports,
+// falling back to fallback when none is detected.
+// inside a multiplexer the terminal outside of it is asked through passthrough,
+// timeout is how long it gets to answer
+func DetectCap(fallback Protocol, passthrough Passthrough, timeout time.Duration) (iterm bool, kitty bool, sixel bool) {
+  passthrough = passthrough.resolve()
+  isKittyCapable := rasterm.IsKittyCapable()
+  isItermCapable := rasterm.IsItermCapable()
+  isSixelCapable := false
+
+  // the multiplexer sets its own TERM, so the environment says little about the terminal
+  askKitty := passthrough != NoPassthrough
+  if !isKittyCapable && !isItermCapable && (askKitty || fallback != Sixel) {
+    kitty, sixel := query_graphics(passthrough, askKitty, timeout)
+    isKittyCapable = kitty
+    if !isKittyCapable && fallback != Sixel {
+      isSixelCapable = sixel
+    }
+  }
+
+  if !isKittyCapable && !isItermCapable && !isSixelCapable {
+    switch fallback {
+    case Kitty:
+      isKittyCapable = true
+    case Iterm:
+      isItermCapable = true
+    case Sixel:
+      isSixelCapable = true
+    }
+  }
+
+  return isItermCapable, isKittyCapable, isSixelCapable
+}
@@ -0,0 +1,237 @@
+package render
+
+import (
+  "bytes"
+  "context"
+  "fmt"
+  "image"
+  "image/color"
+  "image/png"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+  "time"
+)
+
+// test_image is a w x h gradient, so resizing and quantizing have something to work with
+func test_image(w, h int) image.Image {
+  img := image.NewRGBA(image.Rect(0, 0, w, h))
+  for y := 0; y < h; y++ {
+    for x := 0; x < w; x++ {
+      img.Set(x, y, color.RGBA{uint8(x * 255 / w), uint8(y * 255 / h), 0x80, 0xff})
+    }
+  }
+  return img
+}
+
+// test_png encodes test_image
+func test_png(t *testing.T, w, h int) []byte {
+  t.Helper()
+  buf := new(bytes.Buffer)
+  if err := png.Encode(buf, test_image(w, h)); err != nil {
+    t.Fatal(err)
+  }
+  return buf.Bytes()
+}
+
+// test_file writes data into a temp dir, returning its path
+func test_file(t *testing.T, name string, data []byte) string {
+  t.Helper()
+  path := filepath.Join(t.TempDir(), name)
+  if err := os.WriteFile(path, data, 0644); err != nil {
+    t.Fatal(err)
+  }
+  return path
+}
+
+// test_options renders without asking a terminal anything
+func test_options(protocol Protocol) Options {
+  opts := DefaultOptions()
+  opts.Protocol = protocol
+  opts.ScreenPx = "400x300xforce"
+  opts.ScreenCell = "40x20xforce"
+  opts.Cache = false
+  opts.Passthrough = NoPassthrough
+  return opts
+}
+
+func TestRender(t *testing.T) {
+  path := test_file(t, "img.png", test_png(t, 64, 48))
+  tests := []struct {
+    protocol Protocol
+    // how the protocol starts an image
+    introducer string
+  }{
+    {Kitty, "\x1b_G"},
+    {Iterm, "\x1b]1337;File="},
+    {Sixel, "\x1bP"},
+    {Blocks, "▀"},
+  }
+  for _, tt := range tests {
+    t.Run(string(tt.protocol), func(t *testing.T) {
+      out := new(bytes.Buffer)
+      if err := Render(context.Background(), out, path, test_options(tt.protocol)); err != nil {
+        t.Fatal(err)
+      }
+      if !strings.Contains(out.String(), tt.introducer) {
+        t.Errorf("output doesn't start a %s image: %q", tt.protocol, out.String()[:min(out.Len(), 40)])
+      }
+    })
+  }
+}
+
+func TestRenderMissingFile(t *testing.T) {
+  path := filepath.Join(t.TempDir(), "missing.png")
+  if err := Render(context.Background(), new(bytes.Buffer), path, test_options(Kitty)); err == nil {
+    t.Error("rendering a missing file succeeded")
+  }
+}
+
+func TestRenderReport(t *testing.T) {
+  path := test_file(t, "img.png", test_png(t, 100, 60))
+  tests := []struct {
+    name     string
+    protocol Protocol
+    align    Align
+    place    Place
+    id       uint32
+    want     Report
+  }{
+    // centered by default, relative to the cursor
+    {"inline", Sixel, AlignInline, Place{}, 0, Report{Protocol: Sixel, Width: 100, Height: 60, Cols: 10, Rows: 4, X: 15}},
+    {"aligned", Sixel, "bottom-right", Place{}, 0, Report{Protocol: Sixel, Width: 100, Height: 60, Cols: 10, Rows: 4, X: 30, Y: 15, Absolute: true}},
+    {"placed", Blocks, AlignInline, Place{Cols: 10, Rows: 4, X: 2, Y: 3}, 0, Report{Protocol: Blocks, Width: 100, Height: 60, Cols: 10, Rows: 4, X: 2, Y: 3, Absolute: true}},
+    {"kitty id", Kitty, AlignInline, Place{}, 42, Report{Protocol: Kitty, Width: 100, Height: 60, Cols: 10, Rows: 4, X: 15, ImageID: 42}},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      opts := test_options(tt.protocol)
+      opts.Align, opts.Place, opts.ImageID = tt.align, tt.place, tt.id
+      out := new(bytes.Buffer)
+      var got *Report
+      opts.Report = func(r Report) {
+        // only reported once the image is out
+        if !strings.HasSuffix(out.String(), "\n") && !strings.HasSuffix(out.String(), "\x1b8") {
+          t.Errorf("reported before the image was written: %q", out.String())
+        }
+        got = &r
+      }
+      if err := Render(context.Background(), out, path, opts); err != nil {
+        t.Fatal(err)
+      }
+      if got == nil {
+        t.Fatal("nothing was reported")
+      }
+      if *got != tt.want {
+        t.Errorf("got %+v, want %+v", *got, tt.want)
+      }
+    })
+  }
+}
+
+func TestRenderReportNamesKittyImages(t *testing.T) {
+  // an unnamed kitty image gets an id, so the caller can clear it
+  path := test_file(t, "img.png", test_png(t, 64, 48))
+  opts := test_options(Kitty)
+  var got Report
+  opts.Report = func(r Report) { got = r }
+  out := new(bytes.Buffer)
+  if err := Render(context.Background(), out, path, opts); err != nil {
+    t.Fatal(err)
+  }
+  if got.ImageID == 0 {
+    t.Fatal("kitty image wasn't given an id")
+  }
+  if id := kitty_commands(out.String())[0]["i"]; id != fmt.Sprint(got.ImageID) {
+    t.Errorf("drew i=%s, reported %d", id, got.ImageID)
+  }
+}
+
+func TestKittyImagesAreQuiet(t *testing.T) {
+  // a named image would have kitty answer OK into the tty
+  path := test_file(t, "img.png", test_png(t, 64, 48))
+  tests := []struct {
+    name   string
+    id     uint32
+    report bool
+  }{
+    {"unnamed", 0, false},
+    {"named", 5, false},
+    {"named for the report", 0, true},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      opts := test_options(Kitty)
+      opts.ImageID = tt.id
+      if tt.report {
+        opts.Report = func(Report) {}
+      }
+      out := new(bytes.Buffer)
+      if err := Render(context.Background(), out, path, opts); err != nil {
+        t.Fatal(err)
+      }
+      if cmd := kitty_commands(out.String())[0]; cmd["q"] != "2" {
+        t.Errorf("command %v lets the terminal answer", cmd)
+      }
+    })
+  }
+}
+
+// text can't be redrawn in place and a buffer isn't a terminal, so neither plays the animation
+func TestAnimationDrawsOnce(t *testing.T) {
+  for _, protocol := range []Protocol{Ascii, Blocks, Braille, Sixel, Iterm} {
+    t.Run(string(protocol), func(t *testing.T) {
+      ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+      defer cancel()
+
+      path := test_file(t, "anim.gif", test_gif(t, 32, 32, 3, 0))
+      out := new(bytes.Buffer)
+      if err := Render(ctx, out, path, test_options(protocol)); err != nil {
+        t.Fatal(err)
+      }
+      // the animation loops forever, only drawing a single frame lets the render end
+      if ctx.Err() != nil {
+        t.Fatal("render played the animation")
+      }
+      for _, escape := range []string{"\x1b7", "\x1b[?25l"} {
+        if strings.Contains(out.String(), escape) {
+          t.Errorf("output contains the cursor escape %q", escape)
+        }
+      }
+    })
+  }
+}
+
+func TestRenderMinimalOptions(t *testing.T) {
+  // options left empty fall back to the defaults rather than panic
+  path := test_file(t, "img.png", test_png(t, 64, 48))
+  tests := []struct {
+    name string
+    opts Options
+    // without a terminal to detect, there is no protocol to draw with
+    wantErr bool
+  }{
+    {"zero", Options{}, true},
+    {"protocol only", Options{Protocol: Blocks}, false},
+    {"one sided sizes", Options{Protocol: Blocks, ScreenPx: "1920", ScreenCell: "120", Scale: "2"}, false},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      out := new(bytes.Buffer)
+      err := Render(context.Background(), out, path, tt.opts)
+      if tt.wantErr {
+        if err == nil {
+          t.Error("rendered without a protocol")
+        }
+        return
+      }
+      if err != nil {
+        t.Fatal(err)
+      }
+      if out.Len() == 0 {
+        t.Error("nothing was drawn")
+      }
+    })
+  }
+}
@@ -0,0 +1,128 @@
+package render
+
+import (
+  "fmt"
+  "image/color"
+  "os"
+  "strconv"
+  "strings"
+  "sync"
+  "time"
+)
+
+// terminalColors are the colors the terminal draws with, nil for the ones it didn't tell
+type terminalColors struct {
+  fg, bg color.Color
+  // ansi holds the 16 ansi colors, nil unless the terminal reported all of them
+  ansi color.Palette
+}
+
+var (
+  colorsOnce sync.Once
+  colors     terminalColors
+)
+
+// terminal_colors asks the terminal once, every later call gets the same answer
+func terminal_colors(timeout time.Duration) terminalColors {
+  colorsOnce.Do(func() {
+    colors = query_terminal_colors(timeout)
+  })
+  return colors
+}
+
+// query_terminal_colors asks for the foreground, background and the 16 ansi colors in one round trip
+func query_terminal_colors(timeout time.Duration) terminalColors {
+  queries := []string{"\x1b]10;?\x1b\\", "\x1b]11;?\x1b\\"}
+  for i := range ansi16 {
+    queries = append(queries, fmt.Sprintf("\x1b]4;%d;?\x1b\\", i))
+  }
+  replies, err := query_terminal(NoPassthrough, timeout, queries...)
+  if err != nil {
+    logger.Write(fmt.Sprintf("terminal colors: %v", err))
+  }
+
+  var colors terminalColors
+  //\x1b]11;rgb:1e1e/2020/2929\x1b\\
+  if fg, err := osc_color(replies, "10;"); err == nil {
+    colors.fg = fg
+  }
+  if bg, err := osc_color(replies, "11;"); err == nil {
+    colors.bg = bg
+  }
+  ansi := make(color.Palette, 0, len(ansi16))
+  for i := range ansi16 {
+    c, err := osc_color(replies, fmt.Sprintf("4;%d;", i))
+    if err != nil {
+      break
+    }
+    ansi = append(ansi, c)
+  }
+  if len(ansi) == len(ansi16) {
+    colors.ansi = ansi
+  }
+  return colors
+}
+
+// osc_color finds the reply of the OSC color query starting with prefix, like "11;" for the background
+func osc_color(replies []reply, prefix string) (color.RGBA, error) {
+  response, ok := find_string(replies, ']', prefix)
+  if !ok {
+    return color.RGBA{}, fmt.Errorf("no %s color response", prefix)
+  }
+  return parse_osc_color(response)
+}
+
+// parse_osc_color reads the rgb:R/G/B reply of an OSC color query, each channel 1 to 4 hex digits
+func parse_osc_color(response string) (color.RGBA, error) {
+  start := strings.Index(response, "rgb:")
+  if start < 0 {
+    return color.RGBA{}, fmt.Errorf("unexpected color response: %q", response)
+  }
+  body := response[start+len("rgb:"):]
+  channels := strings.Split(body, "/")
+  if len(channels) != 3 {
+    return color.RGBA{}, fmt.Errorf("unexpected color response: %q", response)
+  }
+  var rgb [3]uint8
+  for i, channel := range channels {
+    value, err := strconv.ParseUint(channel, 16, 16)
+    if err != nil || len(channel) == 0 || len(channel) > 4 {
+      return color.RGBA{}, fmt.Errorf("unexpected color response: %q", response)
+    }
+    // scale from however many digits the terminal sent to 8 bits
+    rgb[i] = uint8(value * 0xff / (1<<(4*len(channel)) - 1))
+  }
+  return color.RGBA{rgb[0], rgb[1], rgb[2], 0xff}, nil
+}
+
+// colorfgbg reads the ansi index of the foreground and background from COLORFGBG,
+// which is fg;bg or fg;default;bg. ok is false when it isn't set
+func colorfgbg() (fg, bg int, ok bool) {
+  parts := strings.Split(os.Getenv("COLORFGBG"), ";")
+  fg, errFg := strconv.Atoi(parts[0])
+  bg, errBg := strconv.Atoi(parts[len(parts)-1])
+  return fg, bg, errFg == nil && errBg == nil && len(parts) > 1 && fg >= 0 && bg >= 0
+}
+
+// dark_background reports if the terminal background is dark, asking the terminal first
+// and then COLORFGBG, an unknown background counts as light
+func dark_background(timeout time.Duration) bool {
+  if bg := terminal_colors(timeout).bg; bg != nil {
+    return luminance(bg) < 0.5
+  }
+  _, bg, ok := colorfgbg()
+  return ok && (bg < 7 || bg == 8)
+}
+
+// light_background reports if the terminal draws dark text on a light background,
+// unknown colors count as the usual light text on dark
+func light_background(timeout time.Duration) bool {
+  colors := terminal_colors(timeout)
+  if colors.fg != nil && colors.bg != nil {
+    return luminance(colors.bg) > luminance(colors.fg)
+  }
+  if fg, bg, ok := colorfgbg(); ok && bg < len(ansi16) && fg < len(ansi16) {
+    return luminance(ansi16[bg]) > luminance(ansi16[fg])
+  }
+  return false
+}
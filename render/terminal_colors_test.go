@@ -0,0 +1,183 @@
+package render
+
+import (
+  "bytes"
+  "context"
+  "fmt"
+  "image/color"
+  "image/png"
+  "testing"
+)
+
+func TestParseOscColor(t *testing.T) {
+  tests := []struct {
+    input   string
+    want    color.RGBA
+    wantErr bool
+  }{
+    {"11;rgb:1e1e/2020/2929", color.RGBA{0x1e, 0x20, 0x29, 0xff}, false},
+    {"10;rgb:ffff/ffff/ffff", color.RGBA{0xff, 0xff, 0xff, 0xff}, false},
+    {"4;1;rgb:cd/00/00", color.RGBA{0xcd, 0x00, 0x00, 0xff}, false},
+    // one and three digits per channel are scaled to 8 bits
+    {"11;rgb:f/8/0", color.RGBA{0xff, 0x88, 0x00, 0xff}, false},
+    {"11;rgb:fff/800/000", color.RGBA{0xff, 0x7f, 0x00, 0xff}, false},
+    {"11;rgb:ffff/ffff", color.RGBA{}, true},
+    {"11;rgb:fffff/0/0", color.RGBA{}, true},
+    {"11;rgb:ff//00", color.RGBA{}, true},
+    {"11;rgb:gg/00/00", color.RGBA{}, true},
+    {"11;#1e2029", color.RGBA{}, true},
+    {"", color.RGBA{}, true},
+  }
+  for _, tt := range tests {
+    t.Run(tt.input, func(t *testing.T) {
+      got, err := parse_osc_color(tt.input)
+      if tt.wantErr {
+        if err == nil {
+          t.Errorf("parse_osc_color(%q) = %v, want an error", tt.input, got)
+        }
+        return
+      }
+      if err != nil || got != tt.want {
+        t.Errorf("parse_osc_color(%q) = %v, %v, want %v", tt.input, got, err, tt.want)
+      }
+    })
+  }
+}
+
+func TestColorfgbg(t *testing.T) {
+  tests := []struct {
+    env    string
+    fg, bg int
+    ok     bool
+  }{
+    {"15;0", 15, 0, true},
+    {"0;default;15", 0, 15, true},
+    {"15", 0, 0, false},
+    {"default;0", 0, 0, false},
+    {"-1;0", 0, 0, false},
+    {"", 0, 0, false},
+  }
+  for _, tt := range tests {
+    t.Run(tt.env, func(t *testing.T) {
+      t.Setenv("COLORFGBG", tt.env)
+      fg, bg, ok := colorfgbg()
+      if ok != tt.ok || (ok && (fg != tt.fg || bg != tt.bg)) {
+        t.Errorf("got %d, %d, %v, want %d, %d, %v", fg, bg, ok, tt.fg, tt.bg, tt.ok)
+      }
+    })
+  }
+}
+
+func TestLightBackground(t *testing.T) {
+  // the terminal can't be asked in tests, so COLORFGBG decides
+  tests := []struct {
+    env  string
+    want bool
+  }{
+    {"0;15", true},
+    {"0;7", true},
+    {"15;0", false},
+    {"7;8", false},
+    {"", false},
+    // past the 16 ansi colors nothing is known
+    {"0;231", false},
+  }
+  for _, tt := range tests {
+    t.Run(tt.env, func(t *testing.T) {
+      t.Setenv("COLORFGBG", tt.env)
+      if got := light_background(DefaultQueryTimeout); got != tt.want {
+        t.Errorf("got %v, want %v", got, tt.want)
+      }
+    })
+  }
+}
+
+// gruvbox's ansi colors, reported by a terminal that was themed
+var themed = func() color.Palette {
+  p := append(color.Palette{}, ansi16...)
+  p[1] = color.RGBA{0xcc, 0x24, 0x1d, 0xff}
+  p[4] = color.RGBA{0x45, 0x85, 0x88, 0xff}
+  return p
+}()
+
+func TestPaletteUsesTheTerminalColors(t *testing.T) {
+  tests := []struct {
+    depth ColorDepth
+    ansi  color.Palette
+    c     color.Color
+    fg    bool
+    want  string
+  }{
+    // xterm has no color near gruvbox blue, the theme does
+    {Colors16, nil, color.RGBA{0x45, 0x85, 0x88, 0xff}, false, "\x1b[100m"},
+    {Colors16, themed, color.RGBA{0xcc, 0x24, 0x1d, 0xff}, true, "\x1b[31m"},
+    {Colors16, themed, color.RGBA{0x45, 0x85, 0x88, 0xff}, false, "\x1b[44m"},
+    // the cube and gray ramp stay as xterm defines them
+    {Colors256, themed, color.RGBA{0xcc, 0x24, 0x1d, 0xff}, true, "\x1b[38;5;1m"},
+    {Colors256, themed, color.RGBA{0xff, 0x87, 0x00, 0xff}, true, "\x1b[38;5;208m"},
+  }
+  for _, tt := range tests {
+    t.Run(fmt.Sprint(tt.depth, tt.want), func(t *testing.T) {
+      st := textStyle{depth: tt.depth, palette: tt.depth.palette(tt.ansi)}
+      if got := st.sgr(tt.c, tt.fg); got != tt.want {
+        t.Errorf("got %q, want %q", got, tt.want)
+      }
+    })
+  }
+  if TrueColor.palette(themed) != nil {
+    t.Error("true color was given a palette")
+  }
+}
+
+func TestInk(t *testing.T) {
+  white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+  tests := []struct {
+    name  string
+    light bool
+    c     color.Color
+    want  float64
+  }{
+    {"white on dark", false, white, 1},
+    {"white on light", true, white, 0},
+    {"red on light", true, red, 1 - 0.2126},
+    {"transparent on light", true, none, 0},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      if got := (textStyle{light: tt.light}).ink(tt.c); got < tt.want-0.001 || got > tt.want+0.001 {
+        t.Errorf("got %f, want %f", got, tt.want)
+      }
+    })
+  }
+}
+
+func TestRenderBrailleOnALightBackground(t *testing.T) {
+  white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+  buf := new(bytes.Buffer)
+  if err := png.Encode(buf, flat_page(40, 60, white)); err != nil {
+    t.Fatal(err)
+  }
+  path := test_file(t, "white.png", buf.Bytes())
+  tests := []struct {
+    colorfgbg string
+    // a white page is all ink on a dark terminal and none on a light one
+    want rune
+  }{
+    {"15;0", '⣿'},
+    {"0;15", '⠀'},
+  }
+  for _, tt := range tests {
+    t.Run(tt.colorfgbg, func(t *testing.T) {
+      t.Setenv("COLORFGBG", tt.colorfgbg)
+      out := new(bytes.Buffer)
+      if err := Render(context.Background(), out, path, test_options(Braille)); err != nil {
+        t.Fatal(err)
+      }
+      for _, r := range out.String() {
+        if r >= 0x2800 && r <= 0x28ff && r != tt.want {
+          t.Fatalf("drew %q, want only %q", out.String(), tt.want)
+        }
+      }
+    })
+  }
+}
@@ -0,0 +1,325 @@
+package render
+
+import (
+  "bufio"
+  "fmt"
+  "image"
+  "image/color"
+  "io"
+  "os"
+  "strings"
+
+  "github.com/nfnt/resize"
+)
+
+type ColorDepth int
+
+const (
+  TrueColor ColorDepth = iota
+  Colors256
+  Colors16
+)
+
+// detect_color_depth guesses how many colors the terminal can show from COLORTERM and TERM
+func detect_color_depth() ColorDepth {
+  colorterm := strings.ToLower(os.Getenv("COLORTERM"))
+  if colorterm == "truecolor" || colorterm == "24bit" {
+    return TrueColor
+  }
+  term := strings.ToLower(os.Getenv("TERM"))
+  if strings.Contains(term, "direct") || strings.Contains(term, "truecolor") {
+    return TrueColor
+  }
+  if strings.Contains(term, "256") {
+    return Colors256
+  }
+  return Colors16
+}
+
+// the 16 ansi colors as xterm shows them
+var ansi16 = color.Palette{
+  color.RGBA{0x00, 0x00, 0x00, 0xff},
+  color.RGBA{0xcd, 0x00, 0x00, 0xff},
+  color.RGBA{0x00, 0xcd, 0x00, 0xff},
+  color.RGBA{0xcd, 0xcd, 0x00, 0xff},
+  color.RGBA{0x00, 0x00, 0xee, 0xff},
+  color.RGBA{0xcd, 0x00, 0xcd, 0xff},
+  color.RGBA{0x00, 0xcd, 0xcd, 0xff},
+  color.RGBA{0xe5, 0xe5, 0xe5, 0xff},
+  color.RGBA{0x7f, 0x7f, 0x7f, 0xff},
+  color.RGBA{0xff, 0x00, 0x00, 0xff},
+  color.RGBA{0x00, 0xff, 0x00, 0xff},
+  color.RGBA{0xff, 0xff, 0x00, 0xff},
+  color.RGBA{0x5c, 0x5c, 0xff, 0xff},
+  color.RGBA{0xff, 0x00, 0xff, 0xff},
+  color.RGBA{0x00, 0xff, 0xff, 0xff},
+  color.RGBA{0xff, 0xff, 0xff, 0xff},
+}
+
+// the xterm 256 color palette, the 16 ansi colors followed by a 6x6x6 cube and a 24 step gray ramp
+var xterm256 = func() color.Palette {
+  p := append(color.Palette{}, ansi16...)
+  steps := []uint8{0x00, 0x5f, 0x87, 0xaf, 0xd7, 0xff}
+  for r := 0; r < 6; r++ {
+    for g := 0; g < 6; g++ {
+      for b := 0; b < 6; b++ {
+        p = append(p, color.RGBA{steps[r], steps[g], steps[b], 0xff})
+      }
+    }
+  }
+  for i := 0; i < 24; i++ {
+    v := uint8(8 + i*10)
+    p = append(p, color.RGBA{v, v, v, 0xff})
+  }
+  return p
+}()
+
+// palette returns the colors the terminal can show, nil for true color.
+// ansi replaces the 16 xterm colors with the ones the terminal really uses, nil keeps them
+func (depth ColorDepth) palette(ansi color.Palette) color.Palette {
+  if ansi == nil {
+    ansi = ansi16
+  }
+  switch depth {
+  case Colors256:
+    return append(append(color.Palette{}, ansi...), xterm256[len(ansi16):]...)
+  case Colors16:
+    return ansi
+  }
+  return nil
+}
+
+// sgr returns the escape that sets the foreground or background to c
+func (st textStyle) sgr(c color.Color, fg bool) string {
+  switch st.depth {
+  case Colors256:
+    code := 48
+    if fg {
+      code = 38
+    }
+    return fmt.Sprintf("\x1b[%d;5;%dm", code, st.palette.Index(c))
+  case Colors16:
+    i := st.palette.Index(c)
+    base := 40
+    if fg {
+      base = 30
+    }
+    if i >= 8 {
+      base += 60
+      i -= 8
+    }
+    return fmt.Sprintf("\x1b[%dm", base+i)
+  default:
+    r, g, b, _ := c.RGBA()
+    code := 48
+    if fg {
+      code = 38
+    }
+    return fmt.Sprintf("\x1b[%d;2;%d;%d;%dm", code, r>>8, g>>8, b>>8)
+  }
+}
+
+// text_grid returns the size in cells img takes on the screen
+func text_grid(img image.Image, sSize ScreenSize) (cols, rows int) {
+  cellW, cellH := 1, 1
+  if sSize.widthCell > 0 && sSize.heightCell > 0 {
+    cellW = max(sSize.widthPx/sSize.widthCell, 1)
+    cellH = max(sSize.heightPx/sSize.heightCell, 1)
+  }
+  bounds := img.Bounds()
+  cols = max((bounds.Dx()+cellW-1)/cellW, 1)
+  rows = max((bounds.Dy()+cellH-1)/cellH, 1)
+  return
+}
+
+func is_opaque(c color.Color) bool {
+  _, _, _, a := c.RGBA()
+  return a >= 0x8000
+}
+
+// how the text renderers draw
+type textStyle struct {
+  // offsetX moves every line right by that many cells
+  offsetX int
+  // positioned output is drawn over the screen, so it can't move its lines with spaces
+  positioned bool
+  depth      ColorDepth
+  // palette of depth, with the terminal's own ansi colors when it reported them
+  palette color.Palette
+  // light is set for dark text on a light background, braille and ascii then draw the dark parts of the image
+  light bool
+  // color is only optional for braille and ascii, blocks are always colored
+  color  bool
+  dither Dither
+}
+
+// reduce dithers img to the colors the terminal can show, transparency is lost
+// so it has to be read from the original
+func (st textStyle) reduce(img image.Image) image.Image {
+  if st.palette == nil {
+    return img
+  }
+  return st.dither.quantize(img, st.palette)
+}
+
+// moves the line right, colored output can use an escape but plain text
+// has to stay plain so it can be pasted around. positioned text is already
+// placed with escapes and spaces would blank what is left of it
+func (st textStyle) writeOffset(w *bufio.Writer, plain bool) {
+  if st.offsetX <= 0 {
+    return
+  }
+  if plain && !st.positioned {
+    w.WriteString(strings.Repeat(" ", st.offsetX))
+    return
+  }
+  fmt.Fprintf(w, "\x1b[%dC", st.offsetX)
+}
+
+// luminance of c in 0..1, transparent pixels count as dark
+func luminance(c color.Color) float64 {
+  r, g, b, a := c.RGBA()
+  if a == 0 {
+    return 0
+  }
+  return (0.2126*float64(r) + 0.7152*float64(g) + 0.0722*float64(b)) / 0xffff
+}
+
+// ink is how strongly c is drawn in 0..1, the bright parts of the image on a dark background
+// and the dark parts on a light one, transparent pixels are never drawn
+func (st textStyle) ink(c color.Color) float64 {
+  if _, _, _, a := c.RGBA(); a == 0 || !st.light {
+    return luminance(c)
+  }
+  return 1 - luminance(c)
+}
+
+// write_blocks draws img with upper half blocks, two pixels per cell
+func write_blocks(out io.Writer, img image.Image, sSize ScreenSize, st textStyle) error {
+  cols, rows := text_grid(img, sSize)
+  small := resize.Resize(uint(cols), uint(rows*2), img, resize.Lanczos3)
+  bounds := small.Bounds()
+  colors := st.reduce(small)
+
+  w := bufio.NewWriter(out)
+  for y := 0; y < rows; y++ {
+    if y > 0 {
+      w.WriteString("\n")
+    }
+    st.writeOffset(w, false)
+    for x := 0; x < cols; x++ {
+      px, py := bounds.Min.X+x, bounds.Min.Y+y*2
+      top, bottom := colors.At(px, py), colors.At(px, py+1)
+      topOpaque, bottomOpaque := is_opaque(small.At(px, py)), is_opaque(small.At(px, py+1))
+
+      // transparent halves show the terminal background
+      switch {
+      case topOpaque && bottomOpaque:
+        w.WriteString(st.sgr(top, true) + st.sgr(bottom, false) + "▀")
+      case topOpaque:
+        w.WriteString("\x1b[0m" + st.sgr(top, true) + "▀")
+      case bottomOpaque:
+        w.WriteString("\x1b[0m" + st.sgr(bottom, true) + "▄")
+      default:
+        w.WriteString("\x1b[0m ")
+      }
+    }
+    w.WriteString("\x1b[0m")
+  }
+
+  return w.Flush()
+}
+
+// the bit of each dot in a braille cell, indexed by [y][x]
+var braille_bits = [4][2]rune{
+  {0x01, 0x08},
+  {0x02, 0x10},
+  {0x04, 0x20},
+  {0x40, 0x80},
+}
+
+// write_braille draws img with braille characters, 2x4 dots per cell,
+// a dot is lit where the image has ink, see textStyle.ink
+func write_braille(out io.Writer, img image.Image, sSize ScreenSize, st textStyle) error {
+  cols, rows := text_grid(img, sSize)
+  small := resize.Resize(uint(cols*2), uint(rows*4), img, resize.Lanczos3)
+  bounds := small.Bounds()
+
+  // reduce to black and white, thresholded or dithered
+  gray := image.NewGray(bounds)
+  for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+    for x := bounds.Min.X; x < bounds.Max.X; x++ {
+      gray.SetGray(x, y, color.Gray{uint8(st.ink(small.At(x, y)) * 0xff)})
+    }
+  }
+  dots := st.dither.quantize(gray, color.Palette{color.Black, color.White})
+
+  w := bufio.NewWriter(out)
+  for y := 0; y < rows; y++ {
+    if y > 0 {
+      w.WriteString("\n")
+    }
+    st.writeOffset(w, !st.color)
+    for x := 0; x < cols; x++ {
+      char := rune(0x2800)
+      var r, g, b, lit uint32
+      for dy := 0; dy < 4; dy++ {
+        for dx := 0; dx < 2; dx++ {
+          px, py := bounds.Min.X+x*2+dx, bounds.Min.Y+y*4+dy
+          if dots.ColorIndexAt(px, py) == 0 {
+            continue
+          }
+          char |= braille_bits[dy][dx]
+          cr, cg, cb, _ := small.At(px, py).RGBA()
+          r, g, b, lit = r+cr, g+cg, b+cb, lit+1
+        }
+      }
+      // colored dots take the average color of the lit pixels
+      if st.color && lit > 0 {
+        avg := color.RGBA64{uint16(r / lit), uint16(g / lit), uint16(b / lit), 0xffff}
+        w.WriteString(st.sgr(avg, true))
+      }
+      w.WriteRune(char)
+    }
+    if st.color {
+      w.WriteString("\x1b[0m")
+    }
+  }
+
+  return w.Flush()
+}
+
+// characters from no ink to the most
+const ascii_ramp = " .:-=+*#%@"
+
+// write_ascii draws img with characters picked by the ink of each cell
+func write_ascii(out io.Writer, img image.Image, sSize ScreenSize, st textStyle) error {
+  cols, rows := text_grid(img, sSize)
+  small := resize.Resize(uint(cols), uint(rows), img, resize.Lanczos3)
+  bounds := small.Bounds()
+  var colors image.Image
+  if st.color {
+    colors = st.reduce(small)
+  }
+
+  w := bufio.NewWriter(out)
+  for y := 0; y < rows; y++ {
+    if y > 0 {
+      w.WriteString("\n")
+    }
+    st.writeOffset(w, !st.color)
+    for x := 0; x < cols; x++ {
+      c := small.At(bounds.Min.X+x, bounds.Min.Y+y)
+      i := int(st.ink(c)*float64(len(ascii_ramp)-1) + 0.5)
+      if st.color && i > 0 {
+        w.WriteString(st.sgr(colors.At(bounds.Min.X+x, bounds.Min.Y+y), true))
+      }
+      w.WriteByte(ascii_ramp[i])
+    }
+    if st.color {
+      w.WriteString("\x1b[0m")
+    }
+  }
+
+  return w.Flush()
+}
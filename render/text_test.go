@@ -0,0 +1,271 @@
+package render
+
+import (
+  "bytes"
+  "image"
+  "image/color"
+  "testing"
+)
+
+var (
+  red  = color.RGBA{0xff, 0, 0, 0xff}
+  blue = color.RGBA{0, 0, 0xff, 0xff}
+  none = color.RGBA{}
+)
+
+// rows_image is a w px wide image with one color per row
+func rows_image(w int, rows ...color.Color) image.Image {
+  img := image.NewRGBA(image.Rect(0, 0, w, len(rows)))
+  for y, c := range rows {
+    for x := 0; x < w; x++ {
+      img.Set(x, y, c)
+    }
+  }
+  return img
+}
+
+// cols_image is an image h px high with one color per column
+func cols_image(h int, cols ...color.Color) image.Image {
+  img := image.NewRGBA(image.Rect(0, 0, len(cols), h))
+  for x, c := range cols {
+    for y := 0; y < h; y++ {
+      img.Set(x, y, c)
+    }
+  }
+  return img
+}
+
+// one_px_cells is a screen whose cells are 1 x 2 px, so every cell holds exactly two pixels
+var one_px_cells = ScreenSize{widthPx: 80, heightPx: 48, widthCell: 80, heightCell: 24}
+
+func TestDetectColorDepth(t *testing.T) {
+  tests := []struct {
+    colorterm string
+    term      string
+    want      ColorDepth
+  }{
+    {"truecolor", "xterm", TrueColor},
+    {"24bit", "", TrueColor},
+    {"", "xterm-direct", TrueColor},
+    {"", "xterm-256color", Colors256},
+    {"", "xterm", Colors16},
+    {"", "", Colors16},
+  }
+  for _, tt := range tests {
+    t.Run(tt.colorterm+"/"+tt.term, func(t *testing.T) {
+      t.Setenv("COLORTERM", tt.colorterm)
+      t.Setenv("TERM", tt.term)
+      if got := detect_color_depth(); got != tt.want {
+        t.Errorf("got %v, want %v", got, tt.want)
+      }
+    })
+  }
+}
+
+func TestSgr(t *testing.T) {
+  orange := color.RGBA{0xff, 0x80, 0x10, 0xff}
+  tests := []struct {
+    name  string
+    c     color.Color
+    depth ColorDepth
+    fg    bool
+    want  string
+  }{
+    {"truecolor fg", orange, TrueColor, true, "\x1b[38;2;255;128;16m"},
+    {"truecolor bg", orange, TrueColor, false, "\x1b[48;2;255;128;16m"},
+    {"256 cube", color.RGBA{0xff, 0x87, 0x00, 0xff}, Colors256, true, "\x1b[38;5;208m"},
+    {"256 gray ramp", color.RGBA{0x80, 0x80, 0x80, 0xff}, Colors256, false, "\x1b[48;5;244m"},
+    {"16 dark", color.RGBA{0xcd, 0, 0, 0xff}, Colors16, true, "\x1b[31m"},
+    {"16 bright", red, Colors16, true, "\x1b[91m"},
+    {"16 bright bg", color.RGBA{0x5c, 0x5c, 0xff, 0xff}, Colors16, false, "\x1b[104m"},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      if got := (textStyle{depth: tt.depth, palette: tt.depth.palette(nil)}).sgr(tt.c, tt.fg); got != tt.want {
+        t.Errorf("got %q, want %q", got, tt.want)
+      }
+    })
+  }
+}
+
+func TestTextGrid(t *testing.T) {
+  sSize := ScreenSize{widthPx: 800, heightPx: 600, widthCell: 80, heightCell: 30}
+  tests := []struct {
+    name       string
+    w, h       int
+    sSize      ScreenSize
+    cols, rows int
+  }{
+    {"exact", 100, 40, sSize, 10, 2},
+    {"rounds up", 101, 41, sSize, 11, 3},
+    {"at least a cell", 1, 1, sSize, 1, 1},
+    {"unknown screen is a px per cell", 7, 5, ScreenSize{}, 7, 5},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      cols, rows := text_grid(test_image(tt.w, tt.h), tt.sSize)
+      if cols != tt.cols || rows != tt.rows {
+        t.Errorf("got %dx%d, want %dx%d", cols, rows, tt.cols, tt.rows)
+      }
+    })
+  }
+}
+
+func TestWriteBlocks(t *testing.T) {
+  const (
+    redFg  = "\x1b[38;2;255;0;0m"
+    blueFg = "\x1b[38;2;0;0;255m"
+    blueBg = "\x1b[48;2;0;0;255m"
+  )
+  tests := []struct {
+    name    string
+    img     image.Image
+    offsetX int
+    want    string
+  }{
+    {"two colors a cell", rows_image(2, red, blue), 0, redFg + blueBg + "▀" + redFg + blueBg + "▀\x1b[0m"},
+    {"lines", rows_image(1, red, blue, blue, red), 0, redFg + blueBg + "▀\x1b[0m\n" + blueFg + "\x1b[48;2;255;0;0m▀\x1b[0m"},
+    {"offset every line", rows_image(1, red, blue, red, blue), 3, "\x1b[3C" + redFg + blueBg + "▀\x1b[0m\n\x1b[3C" + redFg + blueBg + "▀\x1b[0m"},
+    {"transparent bottom", rows_image(1, red, none), 0, "\x1b[0m" + redFg + "▀\x1b[0m"},
+    {"transparent top", rows_image(1, none, blue), 0, "\x1b[0m" + blueFg + "▄\x1b[0m"},
+    {"transparent", rows_image(1, none, none), 0, "\x1b[0m \x1b[0m"},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      out := new(bytes.Buffer)
+      if err := write_blocks(out, tt.img, one_px_cells, textStyle{offsetX: tt.offsetX, depth: TrueColor}); err != nil {
+        t.Fatal(err)
+      }
+      if out.String() != tt.want {
+        t.Errorf("got %q, want %q", out.String(), tt.want)
+      }
+    })
+  }
+}
+
+// braille_cells is a screen whose cells are 2 x 4 px, so every pixel is a dot
+var braille_cells = ScreenSize{widthPx: 160, heightPx: 96, widthCell: 80, heightCell: 24}
+
+func TestWriteBraille(t *testing.T) {
+  white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+  black := color.RGBA{0, 0, 0, 0xff}
+  whiteFg := "\x1b[38;2;255;255;255m"
+  tests := []struct {
+    name string
+    img  image.Image
+    st   textStyle
+    want string
+  }{
+    {"full and empty cells", cols_image(4, white, white, black, black), textStyle{}, "⣿⠀"},
+    {"left column", cols_image(4, white, black), textStyle{}, "⡇"},
+    {"right column", cols_image(4, black, white), textStyle{}, "⢸"},
+    {"bottom row", rows_image(2, black, black, black, white), textStyle{}, "⣀"},
+    {"lines", rows_image(2, white, white, white, white, black, black, black, black), textStyle{}, "⣿\n⠀"},
+    {"plain offset is spaces", cols_image(4, white, white), textStyle{offsetX: 2}, "  ⣿"},
+    {"positioned offset is an escape", cols_image(4, white, white), textStyle{offsetX: 2, positioned: true}, "\x1b[2C⣿"},
+    {"colored", cols_image(4, white, white, black, black), textStyle{color: true, depth: TrueColor}, whiteFg + "⣿⠀\x1b[0m"},
+    {"colored offset is an escape", cols_image(4, white, white), textStyle{offsetX: 2, color: true, depth: TrueColor}, "\x1b[2C" + whiteFg + "⣿\x1b[0m"},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      out := new(bytes.Buffer)
+      if err := write_braille(out, tt.img, braille_cells, tt.st); err != nil {
+        t.Fatal(err)
+      }
+      if out.String() != tt.want {
+        t.Errorf("got %q, want %q", out.String(), tt.want)
+      }
+    })
+  }
+}
+
+func TestWriteBrailleDithers(t *testing.T) {
+  // a flat mid gray lights about half the dots instead of none or all
+  gray := color.RGBA{0x80, 0x80, 0x80, 0xff}
+  img := rows_image(16, gray, gray, gray, gray, gray, gray, gray, gray)
+  out := new(bytes.Buffer)
+  if err := write_braille(out, img, braille_cells, textStyle{}); err != nil {
+    t.Fatal(err)
+  }
+  lit := 0
+  for _, r := range out.String() {
+    for bits := r - 0x2800; bits > 0; bits >>= 1 {
+      lit += int(bits & 1)
+    }
+  }
+  if lit < 48 || lit > 80 {
+    t.Errorf("%d of 128 dots lit, want about half: %q", lit, out.String())
+  }
+}
+
+func TestWriteAscii(t *testing.T) {
+  white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+  gray := color.RGBA{0x80, 0x80, 0x80, 0xff}
+  black := color.RGBA{0, 0, 0, 0xff}
+  tests := []struct {
+    name string
+    img  image.Image
+    st   textStyle
+    want string
+  }{
+    {"ramp", cols_image(1, black, gray, white), textStyle{}, " +@"},
+    {"transparent is dark", cols_image(1, none, white), textStyle{}, " @"},
+    {"lines", rows_image(1, white, black), textStyle{}, "@\n "},
+    {"plain offset is spaces", cols_image(1, white), textStyle{offsetX: 3}, "   @"},
+    {"positioned offset is an escape", cols_image(1, white), textStyle{offsetX: 3, positioned: true}, "\x1b[3C@"},
+    {"colored", cols_image(1, black, gray, white), textStyle{color: true, depth: TrueColor}, " \x1b[38;2;128;128;128m+\x1b[38;2;255;255;255m@\x1b[0m"},
+    {"colored offset is an escape", cols_image(1, white), textStyle{offsetX: 3, color: true, depth: TrueColor}, "\x1b[3C\x1b[38;2;255;255;255m@\x1b[0m"},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      out := new(bytes.Buffer)
+      if err := write_ascii(out, tt.img, ScreenSize{}, tt.st); err != nil {
+        t.Fatal(err)
+      }
+      if out.String() != tt.want {
+        t.Errorf("got %q, want %q", out.String(), tt.want)
+      }
+    })
+  }
+}
+
+func TestLuminance(t *testing.T) {
+  tests := []struct {
+    name string
+    c    color.Color
+    want float64
+  }{
+    {"black", color.RGBA{0, 0, 0, 0xff}, 0},
+    {"white", color.RGBA{0xff, 0xff, 0xff, 0xff}, 1},
+    {"green is brighter than red", color.RGBA{0, 0xff, 0, 0xff}, 0.7152},
+    {"red", red, 0.2126},
+    {"transparent", color.RGBA{}, 0},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      if got := luminance(tt.c); got < tt.want-0.001 || got > tt.want+0.001 {
+        t.Errorf("got %f, want %f", got, tt.want)
+      }
+    })
+  }
+}
+
+func TestTextReducesToTheTerminalColors(t *testing.T) {
+  // a color of the 256 color cube is drawn with its own index
+  cube := color.RGBA{0x87, 0xaf, 0x5f, 0xff}
+  out := new(bytes.Buffer)
+  st := textStyle{depth: Colors256, palette: Colors256.palette(nil), dither: FloydSteinberg}
+  if err := write_blocks(out, rows_image(2, cube, cube), one_px_cells, st); err != nil {
+    t.Fatal(err)
+  }
+  cell := "\x1b[38;5;107m\x1b[48;5;107m▀"
+  if got, want := out.String(), cell+cell+"\x1b[0m"; got != want {
+    t.Errorf("got %q, want %q", got, want)
+  }
+
+  // true color needs no reducing
+  img := test_image(4, 4)
+  if (textStyle{depth: TrueColor}).reduce(img) != img {
+    t.Error("true color output was reduced")
+  }
+}
@@ -0,0 +1,173 @@
+package render
+
+import (
+  "fmt"
+  "image"
+  "image/draw"
+  "math"
+  "strings"
+)
+
+// Region is the part of the source image to render, x,y,w,h measured like a Dimension,
+// except percent is of the source image instead of the screen
+type Region struct {
+  X, Y, Width, Height Dimension
+}
+
+// ParseRegion parses x,y,w,h where each is a Dimension, an empty string is the zero Region
+func ParseRegion(region string) (Region, error) {
+  if region == "" {
+    return Region{}, nil
+  }
+  parts := strings.Split(region, ",")
+  if len(parts) != 4 {
+    return Region{}, fmt.Errorf("invalid region '%s'. Must be <x>,<y>,<width>,<height>", region)
+  }
+  var sides [4]Dimension
+  for i, part := range parts {
+    dm, err := ParseDimension(strings.TrimSpace(part))
+    if err != nil || dm.value < 0 {
+      return Region{}, fmt.Errorf("invalid region '%s'. Must be <x>,<y>,<width>,<height> of <number>, <number>px, <number>c or <number>%%", region)
+    }
+    sides[i] = dm
+  }
+  r := Region{X: sides[0], Y: sides[1], Width: sides[2], Height: sides[3]}
+  r.X.direction, r.Width.direction = X, X
+  r.Y.direction, r.Height.direction = Y, Y
+  if !r.set() {
+    return Region{}, fmt.Errorf("invalid region '%s'. Must be at least 1x1", region)
+  }
+  return r, nil
+}
+
+// set reports if the region was given, the zero Region is the whole image
+func (r Region) set() bool {
+  return r.Width.value > 0 && r.Height.value > 0
+}
+
+// of returns the pixels dm stands for in a source side of size px
+func (dm Dimension) of(size int, sSize ScreenSize) int {
+  if dm.kind == Percent {
+    return size * dm.value / 100
+  }
+  return dm.GetPixel(sSize)
+}
+
+// rect returns the region within bounds, empty when it lies outside of them
+func (r Region) rect(bounds image.Rectangle, sSize ScreenSize) image.Rectangle {
+  w, h := bounds.Dx(), bounds.Dy()
+  x, y := r.X.of(w, sSize), r.Y.of(h, sSize)
+  rect := image.Rect(x, y, x+r.Width.of(w, sSize), y+r.Height.of(h, sSize))
+  return rect.Add(bounds.Min).Intersect(bounds)
+}
+
+// Flip mirrors the image, FlipNone leaves it as is
+type Flip string
+
+const (
+  FlipNone       Flip = ""
+  FlipHorizontal Flip = "h"
+  FlipVertical   Flip = "v"
+)
+
+// ParseFlip maps a user supplied flip to a Flip
+func ParseFlip(f string) (Flip, error) {
+  switch strings.ToLower(f) {
+  case "":
+    return FlipNone, nil
+  case "h", "horizontal":
+    return FlipHorizontal, nil
+  case "v", "vertical":
+    return FlipVertical, nil
+  }
+  return FlipNone, fmt.Errorf("invalid flip '%s'. Must be h or v", f)
+}
+
+// transform is what is done to the decoded image before it is resized, in the order of the fields
+type transform struct {
+  region Region
+  // degrees to turn the image clockwise
+  degrees float64
+  flip    Flip
+}
+
+func (t transform) apply(img image.Image, sSize ScreenSize) (image.Image, error) {
+  if t.region.set() {
+    rect := t.region.rect(img.Bounds(), sSize)
+    if rect.Empty() {
+      return nil, fmt.Errorf("region is outside of the %dx%d image", img.Bounds().Dx(), img.Bounds().Dy())
+    }
+    // copied so the region starts at 0, 0 like every other image
+    cropped := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+    draw.Draw(cropped, cropped.Bounds(), img, rect.Min, draw.Src)
+    img = cropped
+  }
+  if t.degrees != 0 {
+    img = rotate_degrees(img, t.degrees)
+  }
+  switch t.flip {
+  case FlipHorizontal:
+    img = flip(img, true)
+  case FlipVertical:
+    img = flip(img, false)
+  }
+  return img, nil
+}
+
+// rotate_degrees turns img clockwise, quarter turns are exact, any other angle
+// grows the image to hold the turned one and leaves the corners transparent
+func rotate_degrees(img image.Image, degrees float64) image.Image {
+  degrees = math.Mod(degrees, 360)
+  if quarters := degrees / 90; quarters == math.Trunc(quarters) {
+    return rotate(img, int(quarters))
+  }
+
+  src := to_rgba(img)
+  w, h := float64(src.Bounds().Dx()), float64(src.Bounds().Dy())
+  sin, cos := math.Sincos(degrees * math.Pi / 180)
+  // the small slack keeps float error from adding a column or row
+  newW := int(math.Ceil(math.Abs(w*cos) + math.Abs(h*sin) - 1e-6))
+  newH := int(math.Ceil(math.Abs(w*sin) + math.Abs(h*cos) - 1e-6))
+  dst := image.NewRGBA(image.Rect(0, 0, newW, newH))
+
+  for y := 0; y < newH; y++ {
+    for x := 0; x < newW; x++ {
+      // turn the center of the pixel back to where it came from in src
+      dx, dy := float64(x)+0.5-float64(newW)/2, float64(y)+0.5-float64(newH)/2
+      sx := dx*cos + dy*sin + w/2 - 0.5
+      sy := -dx*sin + dy*cos + h/2 - 0.5
+      copy(dst.Pix[dst.PixOffset(x, y):], bilinear(src, sx, sy))
+    }
+  }
+  return dst
+}
+
+// bilinear samples src between pixels, outside of it is transparent.
+// RGBA is premultiplied, so blending with transparent pixels doesn't darken the edges
+func bilinear(src *image.RGBA, x, y float64) []byte {
+  x0, y0 := int(math.Floor(x)), int(math.Floor(y))
+  fx, fy := x-float64(x0), y-float64(y0)
+  var sum [4]float64
+  for _, p := range []struct {
+    x, y   int
+    weight float64
+  }{
+    {x0, y0, (1 - fx) * (1 - fy)},
+    {x0 + 1, y0, fx * (1 - fy)},
+    {x0, y0 + 1, (1 - fx) * fy},
+    {x0 + 1, y0 + 1, fx * fy},
+  } {
+    if !(image.Point{p.x, p.y}.In(src.Bounds())) {
+      continue
+    }
+    pix := src.Pix[src.PixOffset(p.x, p.y):]
+    for i := range sum {
+      sum[i] += float64(pix[i]) * p.weight
+    }
+  }
+  out := make([]byte, 4)
+  for i, v := range sum {
+    out[i] = uint8(math.Min(math.Round(v), 255))
+  }
+  return out
+}
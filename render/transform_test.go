@@ -0,0 +1,195 @@
+package render
+
+import (
+  "bytes"
+  "context"
+  "image"
+  "image/color"
+  "testing"
+)
+
+func TestParseRegion(t *testing.T) {
+  x := func(value int, kind DimensionType) Dimension { return Dimension{value, kind, X} }
+  y := func(value int, kind DimensionType) Dimension { return Dimension{value, kind, Y} }
+
+  tests := []struct {
+    input   string
+    want    Region
+    wantErr bool
+  }{
+    {"", Region{}, false},
+    {"10,20,300,200", Region{x(10, Pixel), y(20, Pixel), x(300, Pixel), y(200, Pixel)}, false},
+    {"0, 0, 50%, 50%", Region{x(0, Pixel), y(0, Pixel), x(50, Percent), y(50, Percent)}, false},
+    {"2c,1c,10c,5PX", Region{x(2, Cell), y(1, Cell), x(10, Cell), y(5, Pixel)}, false},
+    {"10,20,300", Region{}, true},
+    {"10,20,300,200,1", Region{}, true},
+    {"-10,20,300,200", Region{}, true},
+    {"10,20,0,200", Region{}, true},
+    {"10,20,300,0%", Region{}, true},
+    {"a,b,c,d", Region{}, true},
+  }
+  for _, tt := range tests {
+    t.Run(tt.input, func(t *testing.T) {
+      got, err := ParseRegion(tt.input)
+      if tt.wantErr {
+        if err == nil {
+          t.Errorf("ParseRegion(%q) = %v, want an error", tt.input, got)
+        }
+        return
+      }
+      if err != nil || got != tt.want {
+        t.Errorf("ParseRegion(%q) = %v, %v, want %v", tt.input, got, err, tt.want)
+      }
+    })
+  }
+}
+
+func TestRegionRect(t *testing.T) {
+  // 10x20 px cells
+  sSize := ScreenSize{widthPx: 800, heightPx: 600, widthCell: 80, heightCell: 30}
+  bounds := image.Rect(0, 0, 200, 100)
+
+  tests := []struct {
+    region string
+    want   image.Rectangle
+  }{
+    {"10,20,30,40", image.Rect(10, 20, 40, 60)},
+    {"50%,50%,50%,50%", image.Rect(100, 50, 200, 100)},
+    {"1c,1c,2c,2c", image.Rect(10, 20, 30, 60)},
+    // clipped to the image
+    {"150,80,100,100", image.Rect(150, 80, 200, 100)},
+    {"300,0,10,10", image.Rectangle{}},
+  }
+  for _, tt := range tests {
+    t.Run(tt.region, func(t *testing.T) {
+      r, err := ParseRegion(tt.region)
+      if err != nil {
+        t.Fatal(err)
+      }
+      if got := r.rect(bounds, sSize); got != tt.want && !(got.Empty() && tt.want.Empty()) {
+        t.Errorf("got %v, want %v", got, tt.want)
+      }
+    })
+  }
+}
+
+func TestParseFlip(t *testing.T) {
+  tests := []struct {
+    input   string
+    want    Flip
+    wantErr bool
+  }{
+    {"", FlipNone, false},
+    {"h", FlipHorizontal, false},
+    {"Horizontal", FlipHorizontal, false},
+    {"v", FlipVertical, false},
+    {"vertical", FlipVertical, false},
+    {"x", FlipNone, true},
+    {"both", FlipNone, true},
+  }
+  for _, tt := range tests {
+    t.Run(tt.input, func(t *testing.T) {
+      got, err := ParseFlip(tt.input)
+      if tt.wantErr {
+        if err == nil {
+          t.Errorf("ParseFlip(%q) = %q, want an error", tt.input, got)
+        }
+        return
+      }
+      if err != nil || got != tt.want {
+        t.Errorf("ParseFlip(%q) = %q, %v, want %q", tt.input, got, err, tt.want)
+      }
+    })
+  }
+}
+
+func TestTransformApply(t *testing.T) {
+  // every pixel of the gradient is a different color, so it can be followed around
+  src := test_image(10, 6)
+  region := func(s string) Region {
+    r, err := ParseRegion(s)
+    if err != nil {
+      t.Fatal(err)
+    }
+    return r
+  }
+  tests := []struct {
+    name string
+    t    transform
+    w, h int
+    // where the src pixel at from ends up
+    from, to image.Point
+  }{
+    {"nothing", transform{}, 10, 6, image.Pt(3, 2), image.Pt(3, 2)},
+    {"region", transform{region: region("2,1,4,3")}, 4, 3, image.Pt(2, 1), image.Pt(0, 0)},
+    {"region in percent", transform{region: region("50%,50%,50%,50%")}, 5, 3, image.Pt(5, 3), image.Pt(0, 0)},
+    {"region clipped to the image", transform{region: region("8,4,10,10")}, 2, 2, image.Pt(9, 5), image.Pt(1, 1)},
+    {"quarter turn", transform{degrees: 90}, 6, 10, image.Pt(0, 0), image.Pt(5, 0)},
+    {"counter clockwise", transform{degrees: -90}, 6, 10, image.Pt(0, 0), image.Pt(0, 9)},
+    {"half turn", transform{degrees: 540}, 10, 6, image.Pt(0, 0), image.Pt(9, 5)},
+    {"flip horizontal", transform{flip: FlipHorizontal}, 10, 6, image.Pt(0, 2), image.Pt(9, 2)},
+    {"flip vertical", transform{flip: FlipVertical}, 10, 6, image.Pt(3, 0), image.Pt(3, 5)},
+    // cut out, then turned, then mirrored
+    {"in order", transform{region: region("2,1,4,3"), degrees: 90, flip: FlipHorizontal}, 3, 4, image.Pt(2, 1), image.Pt(0, 0)},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      img, err := tt.t.apply(src, ScreenSize{})
+      if err != nil {
+        t.Fatal(err)
+      }
+      if got := img.Bounds().Size(); got != image.Pt(tt.w, tt.h) {
+        t.Fatalf("size %v, want %dx%d", got, tt.w, tt.h)
+      }
+      at := img.Bounds().Min.Add(tt.to)
+      if got, want := color.RGBAModel.Convert(img.At(at.X, at.Y)), src.At(tt.from.X, tt.from.Y); got != want {
+        t.Errorf("pixel at %v is %v, want %v from %v", tt.to, got, want, tt.from)
+      }
+    })
+  }
+
+  if _, err := (transform{region: region("20,20,5,5")}).apply(src, ScreenSize{}); err == nil {
+    t.Error("a region outside of the image was cut out")
+  }
+}
+
+func TestRotateDegrees(t *testing.T) {
+  img := rotate_degrees(flat_page(20, 10, color.RGBA{0xff, 0, 0, 0xff}), 45)
+  // grown to hold the turned image
+  if got := img.Bounds().Size(); got != image.Pt(22, 22) {
+    t.Errorf("size %v, want 22x22", got)
+  }
+  if _, _, _, a := img.At(0, 0).RGBA(); a != 0 {
+    t.Errorf("corner isn't transparent, alpha %d", a)
+  }
+  if got := color.RGBAModel.Convert(img.At(11, 11)); got != (color.RGBA{0xff, 0, 0, 0xff}) {
+    t.Errorf("center is %v", got)
+  }
+}
+
+func TestRenderTransformed(t *testing.T) {
+  tests := []struct {
+    name string
+    file string
+    data []byte
+  }{
+    {"image", "img.png", test_png(t, 80, 40)},
+    // every frame is turned
+    {"animation", "anim.gif", test_gif(t, 80, 40, 2, 0)},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      opts := test_options(Sixel)
+      opts.Rotate = 90
+      opts.Loop = 1
+      var got Report
+      opts.Report = func(r Report) { got = r }
+      if err := Render(context.Background(), new(bytes.Buffer), test_file(t, tt.file, tt.data), opts); err != nil {
+        t.Fatal(err)
+      }
+      if got.Width != 40 || got.Height != 80 {
+        t.Errorf("drew %dx%d, want 40x80", got.Width, got.Height)
+      }
+    })
+  }
+}